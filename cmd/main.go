@@ -1,22 +1,39 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"go-imk/internal/command"
 	"go-imk/internal/config"
+	"go-imk/internal/dotenv"
 	"go-imk/internal/fsops"
+	"go-imk/internal/git"
+	"go-imk/internal/limits"
 	"go-imk/internal/logger"
+	"go-imk/internal/output"
 	"go-imk/internal/ratelimit"
+	"go-imk/internal/reaper"
+	"go-imk/internal/schedule"
 )
 
 var version string
 
 func main() {
+	// imk runs as a wrapper applying the resource limits to a command (see limits.Run.Wrap).
+	limits.ExecWrapped()
+
 	cfg := config.New(version, fsops.DefaultWalker)
 
 	if err := cfg.ParseCmdArgs(); err != nil {
@@ -49,68 +66,721 @@ func run(cfg *config.Config) error {
 
 	logger.Shoutf("start monitoring: %s", cfg)
 
-	secondaryOutput := os.Stdout
-	var err error
+	// keep the processes that leave the session of the commands (eg. daemonised workers) as
+	// descendants of imk, so that they are killed with the commands.
+	if err := reaper.Enable(); err != nil {
+		logger.Shoutf("error :: %s", err.Error())
+	}
 
-	if cfg.SecondaryCmd != "" && cfg.OutFile != "" {
-		secondaryOutput, err = os.OpenFile(cfg.OutFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-		defer secondaryOutput.Close()
+	secondaryOutput, secondaryErrOutput := io.Writer(os.Stdout), io.Writer(os.Stderr)
+
+	outFiles, err := openOutputFiles(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range outFiles {
+		defer file.Close()
+	}
 
-		logger.Shoutf("redirecting secondary command output to file: %s", cfg.OutFile)
+	if file, ok := outFiles[cfg.OutFile]; ok {
+		secondaryOutput = file
+		logger.Shoutf("redirecting secondary command stdout to file: %s", cfg.OutFile)
+	}
+
+	if file, ok := outFiles[cfg.ErrFile]; ok {
+		secondaryErrOutput = file
+		logger.Shoutf("redirecting secondary command stderr to file: %s", cfg.ErrFile)
+	}
+
+	env, err := newEnvironment(cfg)
+	if err != nil {
+		return err
 	}
 
 	commandRunner := command.NewCommandRunner(
 		cfg.PrimaryCmd,
 		cfg.SecondaryCmd,
 		cfg.TearDownTimeout,
-		secondaryOutput,
-	)
+	).WithDir(cfg.Cwd).WithEnv(env.Vars).WithPty(cfg.Pty).WithSecondaryBeforeRun(func() error {
+		for _, file := range outFiles {
+			if err := file.StartRun(cfg.SecondaryCmd); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if !cfg.Limits.IsZero() {
+		manager := limits.NewManager(cfg.Limits)
+		if err := manager.EnableCgroups(); err != nil {
+			if cfg.Limits.CPU > 0 {
+				return fmt.Errorf("--limit-cpu requires cgroup v2 > %w", err)
+			}
+
+			logger.Shoutf("cgroup v2 is not available - limiting the resources with setrlimit only: %s", err)
+		}
+
+		// the cgroups of the runs are removed once the commands stop.
+		defer func() {
+			if err := manager.Close(); err != nil {
+				logger.Shoutf("unable to restore the cgroup: %s", err)
+			}
+		}()
+
+		commandRunner = commandRunner.WithLimits(manager)
+	}
+
+	defer commandRunner.Stop()
+
+	var input *command.Input
+	if cfg.StdinTo == config.StdinToSecondary {
+		input = command.NewInput()
+		commandRunner = commandRunner.WithSecondaryInput(input)
+	}
+
+	if cfg.Prefix {
+		commandRunner = commandRunner.
+			WithPrimaryOutput(prefixWriter(cfg, 0, os.Stdout), prefixWriter(cfg, 0, os.Stderr)).
+			WithSecondaryOutput(prefixWriter(cfg, 1, secondaryOutput), prefixWriter(cfg, 1, secondaryErrOutput))
+	} else {
+		commandRunner = commandRunner.WithSecondaryOutput(secondaryOutput, secondaryErrOutput)
+	}
 
 	if cfg.RunNow {
-		if err := commandRunner.Run(ctx); err != nil {
+		if err := runCommands(ctx, cfg, commandRunner, nil); err != nil {
 			return err
 		}
 	}
 
 	// often there is a burst of events that comes at about the same time. Eg. IDE saves file and
 	// then runs formatting tool, which results in 2 writes and thus 2 events.
-	// So I'm introducing a rate limiter that would only allow one command per second regardless of
-	// how many events have actuall come.
-	rlimit := ratelimit.New(1, time.Second) // one command per second
+	// So I'm introducing a rate limiter that would only allow --rate commands per second (one by
+	// default) regardless of how many events have actuall come.
+	sess := &session{
+		runner:     commandRunner,
+		pending:    &batch{},
+		env:        env,
+		shortcuts:  make(chan string),
+		newWatcher: newWatcher,
+	}
+
+	if input != nil {
+		go readInput(ctx, cfg, input, sess.shortcuts)
+	}
+
+	if cfg.Rate > 0 {
+		sess.rlimit = ratelimit.New(1, time.Duration(float64(time.Second)/cfg.Rate)).WithBurst(cfg.Burst)
+	}
+
+	if schedules := cfg.Schedules(); len(schedules) > 0 {
+		sess.sched = schedule.NewWatcher(schedules...)
+	}
+
+	for {
+		err := watch(ctx, cfg, sess)
+		if !errors.Is(err, errRestartWatcher) {
+			return err
+		}
+
+		logger.Shoutf("watched files changed - restarting the watcher: %s", cfg)
+	}
+}
+
+// imk commands available when forwarding the input.
+const (
+	shortcutRun     = "r"
+	shortcutRestart = "s"
+	shortcutHelp    = "?"
+)
+
+// inputQueueSize is the number of lines queued for the secondary command while it does not read
+// its input.
+const inputQueueSize = 64
+
+// readInput forwards the lines read from stdin to the secondary command until stdin is closed,
+// then closes the stdin of the command. The lines starting with the escape prefix are imk commands
+// sent to the shortcuts channel (see parseInputLine).
+func readInput(ctx context.Context, cfg *config.Config, input *command.Input, shortcuts chan<- string) {
+	esc := cfg.StdinEscape
+	reader := bufio.NewReader(os.Stdin)
+
+	// the lines are written by another goroutine, so that the imk commands are handled even while
+	// the secondary command does not read its input.
+	forward := make(chan []byte, inputQueueSize)
+	defer close(forward)
+
+	go func() {
+		for data := range forward {
+			_, _ = input.Write(data)
+		}
+
+		_ = input.Close()
+	}()
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		data, shortcut, ok := parseInputLine(line, esc)
+
+		switch {
+		case !ok && data != "":
+			select {
+			case forward <- []byte(data):
+			case <-ctx.Done():
+				return
+			}
+
+		case shortcut == shortcutRun, shortcut == shortcutRestart:
+			select {
+			case shortcuts <- shortcut:
+			case <-ctx.Done():
+				return
+			}
+
+		case shortcut == shortcutHelp:
+			logger.Shoutf("%sr - run the commands, %ss - restart the secondary command, "+
+				"%s%s<text> - send %s<text> to the secondary command", esc, esc, esc, esc, esc)
+
+		case ok:
+			logger.Shoutf("unknown command %q - type %s? for help", strings.TrimSpace(line), esc)
+		}
 
-	watcher := fsops.NewFileWatcher(cfg.Files)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Shoutf("unable to read stdin :: %s", err.Error())
+			}
+
+			return
+		}
+	}
+}
+
+// parseInputLine splits the line read from stdin into the data to forward to the secondary command
+// and the imk command typed after the escape prefix (ok - the line is an imk command). If the
+// prefix is doubled, the line is forwarded with a single prefix.
+func parseInputLine(line, esc string) (data, shortcut string, ok bool) {
+	switch {
+	case strings.HasPrefix(line, esc+esc):
+		return line[len(esc):], "", false
+	case strings.HasPrefix(line, esc):
+		return "", strings.TrimSpace(line[len(esc):]), true
+	default:
+		return line, "", false
+	}
+}
+
+// envReloadDelay is how long to wait for the writes to the env file to finish before reloading it.
+const envReloadDelay = 100 * time.Millisecond
+
+// errRestartWatcher is returned by watch when the list of watched files changed and the watcher
+// needs to be restarted.
+var errRestartWatcher = errors.New("watched files changed")
+
+// session is the state that outlives the restarts of the watcher.
+type session struct {
+	runner  *command.CommandRunner
+	rlimit  *ratelimit.RLimit // nil - no rate limit.
+	pending *batch
+	env     *environment
+	sched   *schedule.Watcher // nil - no periodic runs.
+
+	newWatcher func(*config.Config) fsops.Watcher
+
+	shortcuts chan string // imk commands typed by the user (see --stdin-to).
+}
+
+// watch watches the files and runs the commands on events until the context is cancelled.
+func watch(ctx context.Context, cfg *config.Config, sess *session) error {
+	runner, pending := sess.runner, sess.pending
 
-	events, err := watcher.Watch(ctx)
+	watchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	watcher := sess.newWatcher(cfg)
+
+	// the periodic runs are fed into the same pipeline as the file events.
+	if sess.sched != nil {
+		watcher = fsops.NewMultiWatcher(watcher, sess.sched)
+	}
+
+	events, err := watcher.Watch(watchCtx)
 	if err != nil {
 		return err
 	}
 
-	for event := range events {
-		if !isInterestingOp(event.Op) {
+	walkOptions := cfg.WalkOptions()
+	listed := listedFiles(cfg)
+
+	tracker, err := newOperationTracker(cfg)
+	if err != nil {
+		return err
+	}
+
+	var settled, cooledDown, envChanged <-chan time.Time
+
+	// run runs the commands for the trigger, unless the rate limit drops it. The triggers during
+	// the cooldown after the previous run are processed in one batch once it expires. It reports
+	// whether imk is done (--once).
+	run := func(trigger []string, reason string) (bool, error) {
+		if left := cooldownLeft(cfg.Cooldown, runner.FinishedAt(), time.Now()); left > 0 {
+			for _, path := range trigger {
+				pending.Add(path)
+			}
+
+			if cooledDown == nil {
+				cooledDown = time.After(left)
+			}
+
+			return false, nil
+		}
+
+		if !allowRun(ctx, sess.rlimit) {
+			return false, nil // ignore the trigger per rate limit
+		}
+
+		logger.Shout(reason)
+
+		if err := runCommands(ctx, cfg, runner, trigger); err != nil {
+			return true, err
+		}
+
+		return cfg.OneRun, nil
+	}
+
+	// the changes collected before the watcher was restarted.
+	if len(pending.files) > 0 {
+		cooledDown = time.After(cooldownLeft(cfg.Cooldown, runner.FinishedAt(), time.Now()))
+	}
+
+	for {
+		var event *fsops.Event
+
+		select {
+		case <-envChanged:
+			envChanged = nil
+
+			if changed, err := sess.env.Reload(); err != nil {
+				logger.Shoutf("error :: %s", err.Error())
+			} else if changed {
+				logger.Shoutf("%s changed - restarting the secondary command", cfg.EnvFile)
+				runner.RestartSecondary(ctx)
+			}
+
+			continue
+
+		case <-cooledDown:
+			cooledDown = nil
+
+			files := pending.Take()
+			logger.Shoutf("cooldown is over - processing %d changes", len(files))
+
+			if err := runCommands(ctx, cfg, runner, files); err != nil {
+				return err
+			}
+
+			if cfg.OneRun {
+				return nil
+			}
+
+			continue
+
+		case <-settled:
+			settled = nil
+
+			op, files, done, err := tracker.Settle()
+			if !done {
+				settled = time.After(settleDelay(cfg)) // the index is still locked.
+				continue
+			}
+
+			if err != nil {
+				logger.Shoutf("error :: %s", err.Error())
+			}
+
+			if trigger, reason := operationTrigger(op, files); len(trigger) > 0 {
+				if done, err := run(trigger, reason); done || err != nil {
+					return err
+				}
+			}
+
+			// the operation may have changed the list of files (eg. checkout of another branch).
+			if cfg.HasFileList() {
+				if changed, err := cfg.RefreshFileList(ctx); err != nil {
+					logger.Shoutf("error :: %s", err.Error())
+				} else if changed {
+					return errRestartWatcher
+				}
+			}
+
+			continue
+
+		case shortcut := <-sess.shortcuts:
+			if shortcut == shortcutRestart {
+				logger.Shout("restarting the secondary command")
+				runner.RestartSecondary(ctx)
+
+				continue
+			}
+
+			event = &fsops.Event{Op: fsops.OpManual, Path: "manual run", Time: time.Now()}
+
+		case ev, ok := <-events:
+			if !ok {
+				return watcher.Err()
+			}
+
+			event = ev
+		}
+
+		// changes in the git directory are only used to recognise git operations, the commands
+		// run once the operation settles (and the list of files is refreshed then as well).
+		if tracker != nil && tracker.Track(event.Path) {
+			if tracker.Busy() {
+				settled = time.After(settleDelay(cfg))
+				continue
+			}
+
+			if !cfg.IsRefreshPath(event.Path) {
+				continue
+			}
+		}
+
+		// the environment is reloaded shortly after the env file changes (it is often truncated
+		// before being written), but the primary command is not run.
+		if cfg.IsEnvFile(event.Path) {
+			if event.Op.Has(fsops.OpCreate|fsops.OpWrite) && envChanged == nil {
+				envChanged = time.After(envReloadDelay)
+			}
+
+			continue
+		}
+
+		// with git the index and HEAD are watched to pick up the files added, removed or switched
+		// by git operations.
+		if cfg.IsRefreshPath(event.Path) {
+			changed, err := cfg.RefreshFileList(ctx)
+			if err != nil {
+				logger.Shoutf("error :: %s", err.Error())
+				continue
+			}
+
+			if changed {
+				return errRestartWatcher
+			}
+
 			continue
 		}
 
-		if _, err := rlimit.Lease(ctx, 1); err != nil {
-			continue // ignore event per rate limit
+		if !event.Op.Has(cfg.EventOps|fsops.OpSynthetic) || !walkOptions.Match(event) {
+			continue
+		}
+
+		if tracker != nil && tracker.Busy() {
+			tracker.Suppress(event.Path)
+			continue
 		}
 
-		logger.Shoutf("%s :: %s", event.Op, event.Path)
+		restart := false
 
-		if err := commandRunner.Run(ctx); err != nil {
+		// with a list command (or git) the directories of the listed files are watched, so that new files
+		// can be picked up by re-running the command.
+		if listed != nil && !isListed(listed, event.Path) && !event.Op.Has(fsops.OpSynthetic) {
+			if !event.Op.Has(fsops.OpCreate) || event.IsDir {
+				continue
+			}
+
+			changed, err := cfg.RefreshFileList(ctx)
+			if err != nil {
+				logger.Shoutf("error :: %s", err.Error())
+				continue
+			}
+
+			if !changed {
+				continue
+			}
+
+			if listed = listedFiles(cfg); !isListed(listed, event.Path) {
+				return errRestartWatcher
+			}
+
+			restart = true
+		}
+
+		trigger := eventTrigger(event)
+
+		if done, err := run([]string{trigger}, fmt.Sprintf("%s :: %s", event.Op, trigger)); done || err != nil {
 			return err
 		}
 
-		if cfg.OneRun {
-			break
+		if restart {
+			return errRestartWatcher
+		}
+	}
+}
+
+// batch collects the changes to process in one run. It outlives the restarts of the watcher.
+type batch struct {
+	files []string
+}
+
+func (b *batch) Add(path string) {
+	if !slices.Contains(b.files, path) {
+		b.files = append(b.files, path)
+	}
+}
+
+// Take returns the collected changes and empties the batch.
+func (b *batch) Take() []string {
+	files := b.files
+	b.files = nil
+
+	return files
+}
+
+// environment holds the variables added to the environment of the commands - the variables of
+// the --env-file overridden by the --env ones. It is safe for concurrent use.
+type environment struct {
+	cfg *config.Config
+
+	mu   sync.Mutex
+	vars []string
+}
+
+func newEnvironment(cfg *config.Config) (*environment, error) {
+	env := &environment{cfg: cfg}
+	if _, err := env.Reload(); err != nil {
+		return nil, err
+	}
+
+	return env, nil
+}
+
+// Reload re-reads the --env-file and reports whether the variables have changed.
+func (e *environment) Reload() (bool, error) {
+	vars := make([]string, 0, len(e.cfg.Env))
+
+	if e.cfg.EnvFile != "" {
+		fileVars, err := dotenv.Load(e.cfg.EnvFile)
+		if err != nil {
+			return false, err
+		}
+
+		vars = append(vars, fileVars...)
+	}
+
+	vars = append(vars, e.cfg.Env...)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	changed := !slices.Equal(e.vars, vars)
+	e.vars = vars
+
+	return changed, nil
+}
+
+func (e *environment) Vars() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.vars
+}
+
+// cooldownLeft returns how long is left at the time now until the cooldown after the previous run
+// that finished at the given time expires (zero time - no run yet).
+func cooldownLeft(cooldown time.Duration, finishedAt, now time.Time) time.Duration {
+	if cooldown <= 0 || finishedAt.IsZero() {
+		return 0
+	}
+
+	return max(0, finishedAt.Add(cooldown).Sub(now))
+}
+
+// allowRun reports whether the rate limiter allows another run (nil - no limit).
+func allowRun(ctx context.Context, rlimit *ratelimit.RLimit) bool {
+	if rlimit == nil {
+		return true
+	}
+
+	_, err := rlimit.Lease(ctx, 1)
+
+	return err == nil
+}
+
+// newOperationTracker creates the tracker of git operations, or returns nil if they are not to
+// be recognised.
+func newOperationTracker(cfg *config.Config) (*git.OperationTracker, error) {
+	if !cfg.VCS {
+		return nil, nil
+	}
+
+	return git.NewOperationTracker(cfg.Repo())
+}
+
+// settleDelay returns how long the git directory has to be quiet for an operation to be
+// considered finished. The polling watcher needs at least a couple of scans to notice it.
+func settleDelay(cfg *config.Config) time.Duration {
+	const delay = 300 * time.Millisecond
+
+	if cfg.Backend == config.BackendPoll {
+		return max(delay, 2*cfg.PollInterval)
+	}
+
+	return delay
+}
+
+// operationTrigger returns the trigger of the run after a git operation together with the reason
+// to log. If the operation did not move HEAD (eg. git add), the commands only run if the work tree
+// changed meanwhile (nil - no run).
+func operationTrigger(op *git.Operation, files []string) ([]string, string) {
+	switch {
+	case op != nil:
+		return []string{"git " + op.Name}, "git " + op.String()
+	case len(files) > 0:
+		return files, fmt.Sprintf("%d files changed during a git operation", len(files))
+	default:
+		return nil, ""
+	}
+}
+
+// isListed reports whether the path is one of the listed files or resides in a listed directory.
+func isListed(listed map[string]bool, path string) bool {
+	return listed[path] || listed[filepath.Dir(path)]
+}
+
+// listedFiles returns the set of files produced by the list command or git, or nil if neither
+// is used.
+func listedFiles(cfg *config.Config) map[string]bool {
+	if !cfg.HasFileList() {
+		return nil
+	}
+
+	listed := make(map[string]bool, len(cfg.Files))
+	for _, file := range cfg.Files {
+		listed[filepath.Clean(file)] = true
+	}
+
+	return listed
+}
+
+// newWatcher creates the watcher for the selected backend. In auto mode a polling watcher is
+// used if any of the files resides on a file system that does not support inotify.
+func newWatcher(cfg *config.Config) fsops.Watcher {
+	files := cfg.WatchPaths()
+	opts := fsops.Options{Roots: cfg.Roots(), ContentHash: cfg.Hash}
+
+	switch cfg.Backend {
+	case config.BackendPoll:
+		return fsops.NewPollWatcher(files, cfg.PollInterval).WithOptions(opts)
+
+	case config.BackendFanotify:
+		return fsops.NewFanotifyWatcher(files).WithRecurse(cfg.Recurse).WithOptions(opts)
+
+	case config.BackendAuto:
+		for _, file := range files {
+			if fsType, ok := fsops.UnsupportedFS(file); ok {
+				logger.Shoutf("%s is on %s file system - falling back to polling", file, fsType)
+				return fsops.NewPollWatcher(files, cfg.PollInterval).WithOptions(opts)
+			}
+		}
+	}
+
+	watcher := fsops.NewFileWatcher(files).WithOptions(opts)
+	if cfg.PollFallback {
+		watcher = watcher.WithPollFallback(fsops.DefaultPollInterval)
+	}
+
+	return watcher
+}
+
+// runCommands runs the commands and prints a one-line summary with the run status, duration and
+// the files that triggered the run.
+func runCommands(ctx context.Context, cfg *config.Config, runner *command.CommandRunner, trigger []string) error {
+	if cfg.Clear {
+		logger.ClearScreen()
+	}
+
+	start := time.Now()
+	err := runner.Run(ctx)
+	duration := time.Since(start).Round(time.Millisecond)
+
+	status := "ok"
+	if err != nil || runner.ExitCode() != 0 {
+		status = "failed"
+	}
+
+	logger.Shoutf("%s in %s :: %s", status, duration, describeTrigger(trigger))
+
+	return err
+}
+
+// eventTrigger describes the event that triggered a run - its path, with the previous one if it
+// was renamed (the periodic runs report the schedule as the path).
+func eventTrigger(event *fsops.Event) string {
+	if event.OldPath != "" {
+		return event.Path + " <- " + event.OldPath
+	}
+
+	return event.Path
+}
+
+func describeTrigger(files []string) string {
+	const maxFiles = 3
+
+	switch {
+	case len(files) == 0:
+		return "initial run"
+	case len(files) > maxFiles:
+		return fmt.Sprintf("%s (+%d more)", strings.Join(files[:maxFiles], ", "), len(files)-maxFiles)
+	default:
+		return strings.Join(files, ", ")
+	}
+}
+
+// openOutputFiles opens the secondary command output files keyed by path. If stdout and stderr
+// are sent to the same path, they share the file.
+func openOutputFiles(cfg *config.Config) (map[string]*output.RotatingFile, error) {
+	files := make(map[string]*output.RotatingFile)
+
+	if cfg.SecondaryCmd == "" {
+		return files, nil
+	}
+
+	for _, path := range []string{cfg.OutFile, cfg.ErrFile} {
+		if _, ok := files[path]; ok || path == "" {
+			continue
 		}
+
+		file, err := output.OpenRotatingFile(path)
+		if err != nil {
+			for _, opened := range files {
+				opened.Close()
+			}
+
+			return nil, err
+		}
+
+		files[path] = file.
+			WithTruncate(cfg.Truncate).
+			WithMaxSize(cfg.RotateSize).
+			WithMaxAge(cfg.RotateAge).
+			WithKeep(cfg.RotateKeep)
 	}
 
-	return nil
+	return files, nil
 }
 
-func isInterestingOp(op string) bool {
-	return op == "CREATE" || op == "RENAME" || op == "WRITE"
+// prefixWriter wraps the output of the primary (idx 0) or secondary (idx 1) command with a
+// line-prefixing writer. Colors are only used for the terminal.
+func prefixWriter(cfg *config.Config, idx int, out io.Writer) io.Writer {
+	color := cfg.PrefixColors[idx]
+	if out != os.Stdout && out != os.Stderr {
+		color = "none"
+	}
+
+	return output.NewPrefixWriter(out, cfg.PrefixNames[idx]).
+		WithColor(color).
+		WithTimestamps(cfg.PrefixTime)
 }
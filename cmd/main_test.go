@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-imk/internal/command"
+	"go-imk/internal/config"
+	"go-imk/internal/fsops"
+	"go-imk/test/assert"
+)
+
+func TestParseInputLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		data     string
+		shortcut string
+		ok       bool
+	}{
+		{
+			name: "should forward plain lines",
+			line: "hello\n",
+			data: "hello\n",
+		},
+		{
+			name:     "should recognise commands",
+			line:     "~r\n",
+			shortcut: "r",
+			ok:       true,
+		},
+		{
+			name: "should forward the escaped prefix once",
+			line: "~~r\n",
+			data: "~r\n",
+		},
+		{
+			name:     "should report unknown commands",
+			line:     "~x\n",
+			shortcut: "x",
+			ok:       true,
+		},
+		{
+			name: "should forward the prefix in the middle of a line",
+			line: "a~r\n",
+			data: "a~r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, shortcut, ok := parseInputLine(tt.line, "~")
+			assert.Equal(t, data, tt.data)
+			assert.Equal(t, shortcut, tt.shortcut)
+			assert.Equal(t, ok, tt.ok)
+		})
+	}
+}
+
+func TestDescribeTrigger(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []*fsops.Event
+		want   string
+	}{
+		{
+			name: "should describe the initial run",
+			want: "initial run",
+		},
+		{
+			name:   "should describe a single file",
+			events: []*fsops.Event{{Op: fsops.OpWrite, Path: "src/main.go"}},
+			want:   "src/main.go",
+		},
+		{
+			name: "should list several files",
+			events: []*fsops.Event{
+				{Op: fsops.OpWrite, Path: "a.go"},
+				{Op: fsops.OpCreate, Path: "b.go"},
+			},
+			want: "a.go, b.go",
+		},
+		{
+			name: "should count the files over the limit",
+			events: []*fsops.Event{
+				{Op: fsops.OpWrite, Path: "a.go"},
+				{Op: fsops.OpWrite, Path: "b.go"},
+				{Op: fsops.OpWrite, Path: "c.go"},
+				{Op: fsops.OpWrite, Path: "d.go"},
+				{Op: fsops.OpWrite, Path: "e.go"},
+			},
+			want: "a.go, b.go, c.go (+2 more)",
+		},
+		{
+			name:   "should show the previous path of a renamed file",
+			events: []*fsops.Event{{Op: fsops.OpCreate, Path: "new.go", OldPath: "old.go"}},
+			want:   "new.go <- old.go",
+		},
+		{
+			name:   "should describe the schedule of a periodic run",
+			events: []*fsops.Event{{Op: fsops.OpTimer, Path: "every 5m0s"}},
+			want:   "every 5m0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trigger []string
+			for _, event := range tt.events {
+				trigger = append(trigger, eventTrigger(event))
+			}
+
+			assert.Equal(t, describeTrigger(trigger), tt.want)
+		})
+	}
+}
+
+func TestCooldownLeft(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		cooldown   time.Duration
+		finishedAt time.Time
+		want       time.Duration
+	}{
+		{
+			name:       "should not wait without a cooldown",
+			finishedAt: now,
+			want:       0,
+		},
+		{
+			name:     "should not wait before the first run",
+			cooldown: time.Minute,
+			want:     0,
+		},
+		{
+			name:       "should wait for the rest of the cooldown",
+			cooldown:   time.Minute,
+			finishedAt: now.Add(-20 * time.Second),
+			want:       40 * time.Second,
+		},
+		{
+			name:       "should wait for the whole cooldown right after the run",
+			cooldown:   time.Minute,
+			finishedAt: now,
+			want:       time.Minute,
+		},
+		{
+			name:       "should not wait once the cooldown expired",
+			cooldown:   time.Minute,
+			finishedAt: now.Add(-2 * time.Minute),
+			want:       0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, cooldownLeft(tt.cooldown, tt.finishedAt, now), tt.want)
+		})
+	}
+}
+
+func TestWatch_CooldownBatch(t *testing.T) {
+	dir := t.TempDir()
+
+	runs := filepath.Join(dir, "runs")
+	script := filepath.Join(dir, "run.sh")
+	assert.NoError(t, os.WriteFile(script, []byte("echo run >> "+runs+"\n"), 0o600))
+
+	var files []string
+	for _, name := range []string{"a.go", "b.go"} {
+		files = append(files, filepath.Join(dir, name))
+		assert.NoError(t, os.WriteFile(files[len(files)-1], nil, 0o600))
+	}
+
+	cfg := &config.Config{
+		PrimaryCmd: "sh " + script,
+		Cooldown:   200 * time.Millisecond,
+		OneRun:     true,
+		EventOps:   fsops.OpWrite,
+		MaxDepth:   -1,
+	}
+
+	ctx := context.Background()
+	runner := command.NewCommandRunner(cfg.PrimaryCmd, "", 0)
+
+	// the run the cooldown is measured from.
+	assert.NoError(t, runCommands(ctx, cfg, runner, nil))
+
+	// the events during the cooldown.
+	events := make(chan *fsops.Event, 3)
+	for _, path := range []string{files[0], files[1], files[0]} {
+		events <- fsops.NewEvent(fsops.OpWrite, path, dir)
+	}
+
+	sess := &session{
+		runner:    runner,
+		pending:   &batch{},
+		shortcuts: make(chan string),
+		newWatcher: func(*config.Config) fsops.Watcher {
+			return &fsops.WatcherMock{
+				WatchFunc: func(context.Context) (chan *fsops.Event, error) { return events, nil },
+				ErrFunc:   func() error { return nil },
+			}
+		},
+	}
+
+	// --once - watch returns after the batched run.
+	assert.NoError(t, watch(ctx, cfg, sess))
+
+	data, err := os.ReadFile(runs)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Count(string(data), "run\n"), 2)
+	assert.Equal(t, len(sess.pending.files), 0)
+}
@@ -5,6 +5,5 @@ go 1.25
 require (
 	github.com/fsnotify/fsnotify v1.9.0
 	github.com/spf13/pflag v1.0.10
+	golang.org/x/sys v0.13.0
 )
-
-require golang.org/x/sys v0.13.0 // indirect
@@ -9,10 +9,13 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"go-imk/internal/limits"
 	"go-imk/internal/logger"
+	"go-imk/internal/reaper"
 )
 
 const (
@@ -21,17 +24,40 @@ const (
 	StatusError
 )
 
+type flusher interface {
+	Flush() error
+}
+
 type Command struct {
 	Command string
 	Args    []string
 
 	TearDownTimeout time.Duration
 
-	cmd *exec.Cmd
-	out io.Writer
-
-	wg   sync.WaitGroup
-	pgid int
+	out       io.Writer
+	errOut    io.Writer
+	beforeRun func() error
+	dir       string
+	env       func() []string
+	pty       bool
+	input     *Input
+	limits    *limits.Manager
+
+	wg      sync.WaitGroup
+	killed  atomic.Bool
+	started atomic.Bool
+
+	// held by a run from killing the previous one until its process is started, so that the runs
+	// executed concurrently (eg. the restarts of the secondary command) follow one another.
+	startMu sync.Mutex
+
+	// the state of the last run - Kill reads it while the command is being executed.
+	mu    sync.Mutex
+	cmd   *exec.Cmd
+	pgid  int
+	runID string
+	run   *limits.Run
+	tree  *tracker
 }
 
 func NewCommand(command string) *Command {
@@ -44,6 +70,7 @@ func NewCommand(command string) *Command {
 	cmd := &Command{
 		Command: tokens[0],
 		out:     os.Stdout,
+		errOut:  os.Stderr,
 	}
 
 	if len(tokens) > 1 {
@@ -63,9 +90,61 @@ func (c *Command) WithOutput(out io.Writer) *Command {
 	return c
 }
 
+func (c *Command) WithErrOutput(errOut io.Writer) *Command {
+	c.errOut = errOut
+	return c
+}
+
+// WithBeforeRun sets a hook that is called before every run of the command (eg. to prepare the
+// output files).
+func (c *Command) WithBeforeRun(fn func() error) *Command {
+	c.beforeRun = fn
+	return c
+}
+
+// WithDir sets the working directory of the command (empty - the current directory).
+func (c *Command) WithDir(dir string) *Command {
+	c.dir = dir
+	return c
+}
+
+// WithEnv sets the function providing the variables added to the environment of the command. It
+// is called on every run, so that the environment can change between runs.
+func (c *Command) WithEnv(env func() []string) *Command {
+	c.env = env
+	return c
+}
+
+// WithPty makes the command run under a pseudo-terminal (Linux only). Both stdout and stderr of
+// the command are then sent to the output.
+func (c *Command) WithPty(enabled bool) *Command {
+	c.pty = enabled
+	return c
+}
+
+// WithInput makes the command read its stdin from the input.
+func (c *Command) WithInput(input *Input) *Command {
+	c.input = input
+	return c
+}
+
+// WithLimits restricts the resources available to every run of the command.
+func (c *Command) WithLimits(manager *limits.Manager) *Command {
+	c.limits = manager
+	return c
+}
+
 func (c *Command) Execute(ctx context.Context) error {
+	c.started.Store(true)
+
+	c.startMu.Lock()
+	started := sync.OnceFunc(c.startMu.Unlock)
+	defer started()
+
 	c.Kill()
 	c.wg.Wait()
+	c.cleanUp()
+	c.killed.Store(false)
 
 	if c.TearDownTimeout > 0 {
 		var timeoutCancel context.CancelFunc
@@ -73,36 +152,180 @@ func (c *Command) Execute(ctx context.Context) error {
 		defer timeoutCancel()
 	}
 
+	if c.beforeRun != nil {
+		if err := c.beforeRun(); err != nil {
+			logger.Shoutf("unable to prepare the run [%s]: %s", c.String(), err)
+		}
+	}
+
 	//nolint:gosec // G204 - need to run the command.
-	c.cmd = exec.Command(c.Command, c.Args...)
-	c.cmd.Stderr = os.Stderr
-	c.cmd.Stdout = c.out
+	cmd := exec.Command(c.Command, c.Args...)
+	cmd.Stderr = c.errOut
+	cmd.Stdout = c.out
+	cmd.Dir = c.dir
+
+	env := os.Environ()
+	if c.env != nil {
+		env = append(env, c.env()...)
+	}
+
+	runID := newRunID()
+	cmd.Env = append(env, runID)
 
 	// Run command in its own process group.
-	c.cmd.SysProcAttr = &syscall.SysProcAttr{
+	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setpgid: true,
 		Pgid:    0, // make child process owner of the group
 	}
 
+	// closed before the timeout context is cancelled on return, which must not kill the run.
+	done := make(chan struct{})
+	defer close(done)
+
 	go func() {
-		<-ctx.Done()
-		c.Kill() // handle context cancellation.
+		select {
+		case <-ctx.Done():
+			select {
+			case <-done:
+			default:
+				c.kill(runID) // handle context cancellation.
+			}
+		case <-done:
+		}
 	}()
 
 	c.wg.Add(1)
 	defer c.wg.Done()
+	defer c.flushOutput()
+
+	var pty *ptySession
+	if c.pty {
+		var err error
+		if pty, err = attachPty(cmd, c.input != nil); err != nil {
+			return err
+		}
+	}
+
+	// the parent end of the stdin of the command (the pty master takes the input with a pty).
+	var stdin io.WriteCloser
+
+	if c.input != nil && pty == nil {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+
+		defer r.Close()
+
+		cmd.Stdin = r
+		stdin = w
+	}
+
+	var run *limits.Run
+
+	if c.limits != nil {
+		var err error
+		if run, err = c.limits.Start(); err != nil {
+			logger.Shoutf("unable to limit the resources [%s]: %s", c.String(), err)
+		} else {
+			run.ProcAttr(cmd.SysProcAttr)
+
+			if err := run.Wrap(cmd); err != nil {
+				logger.Shoutf("unable to limit the resources [%s]: %s", c.String(), err)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.cmd, c.runID, c.run, c.pgid, c.tree = cmd, runID, run, 0, nil
+	c.mu.Unlock()
+
+	if err := reaper.Start(cmd); err != nil {
+		if run != nil {
+			c.mu.Lock()
+			c.run = nil
+			c.mu.Unlock()
+
+			_ = run.Close()
+		}
+
+		if pty != nil {
+			pty.Close()
+		}
+
+		if stdin != nil {
+			stdin.Close()
+		}
 
-	if err := c.cmd.Start(); err != nil {
 		return err
 	}
 
+	tree := newTracker(runID, cmd.Process.Pid)
+	go tree.track(done)
+
 	// Record PGID once, while we know the process exists
-	pgid, err := syscall.Getpgid(c.cmd.Process.Pid)
+	pgid, err := syscall.Getpgid(cmd.Process.Pid)
+
+	c.mu.Lock()
+	c.tree = tree
 	if err == nil && pgid > 0 {
 		c.pgid = pgid
 	}
+	c.mu.Unlock()
+
+	// the next run kills this one from now on.
+	started()
+
+	if pty != nil {
+		pty.Started(c.out)
+	}
+
+	// the end of the stdin the input is forwarded to.
+	var input io.WriteCloser
+
+	if c.input != nil {
+		if pty != nil {
+			input = &ptyInput{master: pty.master}
+		} else {
+			input = stdin
+		}
+
+		c.input.attach(input)
+	}
+
+	err = reaper.Wait(cmd)
+
+	// forward the rest of the output before reporting the exit. Closing the stdin first unblocks
+	// any pending write of the input.
+	if stdin != nil {
+		stdin.Close()
+	}
+
+	if pty != nil {
+		pty.Close()
+	}
+
+	if c.input != nil {
+		c.input.detach(input)
+	}
+
+	// the processes left behind are killed with the next run (or when imk exits).
+	if procs := runProcesses(tree, run); len(procs) > 0 && !c.killed.Load() {
+		logger.Shoutf("%d processes still running after exit [%s %s]: %s",
+			len(procs), c.Command, strings.Join(c.Args, " "), joinProcesses(procs))
+	}
+
+	var hits limits.Hits
+	if run != nil {
+		run.Exited(cmd.ProcessState)
+		hits = run.Hits()
+	}
 
-	if err := c.cmd.Wait(); err != nil {
+	if hits.Any() {
+		logger.Shoutf("limit reached [%s %s]: %s", c.Command, strings.Join(c.Args, " "), hits)
+	}
+
+	if err != nil {
 		status, err := exitInfo(err)
 		if err != nil {
 			if status == StatusKill {
@@ -117,6 +340,12 @@ func (c *Command) Execute(ctx context.Context) error {
 			}
 		}
 
+		if status == StatusKill && hits.OOMKills > 0 {
+			logger.Shoutf("process killed by the memory limit [%s %s]",
+				c.Command, strings.Join(c.Args, " "))
+			return nil
+		}
+
 		if status == StatusKill {
 			logger.Shoutf("process terminated by timeout [%s %s]",
 				c.Command, strings.Join(c.Args, " "))
@@ -124,24 +353,89 @@ func (c *Command) Execute(ctx context.Context) error {
 		}
 	}
 
-	logger.Shoutf("exit code %d [%s %s]", c.cmd.ProcessState.ExitCode(),
+	logger.Shoutf("exit code %d [%s %s]", cmd.ProcessState.ExitCode(),
 		c.Command, strings.Join(c.Args, " "))
 
 	return nil
 }
 
+// Kill terminates the process group of the command and the other processes started by its last
+// run (eg. the ones that started a new session).
 func (c *Command) Kill() {
-	if c.cmd == nil || c.pgid == 0 {
+	c.kill("")
+}
+
+// kill kills the last run if it is the given one (any run if empty) - the runs cancelled by their
+// context must not kill the runs that followed.
+func (c *Command) kill(runID string) {
+	c.mu.Lock()
+	cmd, pgid, tree, run := c.cmd, c.pgid, c.tree, c.run
+	last := c.runID
+	c.mu.Unlock()
+
+	if cmd == nil || runID != "" && runID != last {
 		return
 	}
 
-	selfPGID, _ := syscall.Getpgid(0)
-	if selfPGID == c.pgid {
-		logger.Shout("refusing to commit suicide - attempting to kill own process group")
-		return
+	c.killed.Store(true)
+
+	if pgid != 0 {
+		selfPGID, _ := syscall.Getpgid(0)
+		if selfPGID == pgid {
+			logger.Shout("refusing to commit suicide - attempting to kill own process group")
+			return
+		}
+
+		_ = syscall.Kill(-pgid, syscall.SIGTERM)
 	}
 
-	_ = syscall.Kill(-c.pgid, syscall.SIGTERM)
+	for _, p := range runProcesses(tree, run) {
+		_ = syscall.Kill(p.pid, syscall.SIGTERM)
+	}
+}
+
+// Stop kills the command (unless it is being killed already) and waits for all the processes of
+// its last run to exit. A run being started is killed once it starts.
+func (c *Command) Stop() {
+	c.startMu.Lock()
+	defer c.startMu.Unlock()
+
+	if !c.killed.Load() {
+		c.Kill()
+	}
+
+	c.wg.Wait()
+	c.cleanUp()
+}
+
+// Started reports whether the command has been executed before. It is safe to call while the
+// command is being executed.
+func (c *Command) Started() bool {
+	return c.started.Load()
+}
+
+// ExitCode returns the exit code of the last run of the command or -1 if the command has not
+// exited yet or was terminated by a signal.
+func (c *Command) ExitCode() int {
+	c.mu.Lock()
+	cmd := c.cmd
+	c.mu.Unlock()
+
+	if cmd == nil || cmd.ProcessState == nil {
+		return -1
+	}
+
+	return cmd.ProcessState.ExitCode()
+}
+
+// flushOutput flushes the output writers that buffer data (eg. line-prefixing writers) so that
+// a trailing partial line is not lost when the process exits.
+func (c *Command) flushOutput() {
+	for _, w := range []io.Writer{c.out, c.errOut} {
+		if f, ok := w.(flusher); ok {
+			_ = f.Flush()
+		}
+	}
 }
 
 func (c *Command) String() string {
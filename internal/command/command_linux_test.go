@@ -0,0 +1,121 @@
+package command
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-imk/internal/reaper"
+	"go-imk/test/assert"
+)
+
+func TestMain(m *testing.M) {
+	if err := reaper.Enable(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestCommand_StopSetsid(t *testing.T) {
+	cmd := NewCommand("sh")
+	cmd.Args = []string{"-c", "setsid sleep 30 & sleep 30"}
+
+	go cmd.Execute(context.Background())
+
+	procs := waitProcesses(t, cmd, 3)
+
+	cmd.Stop()
+
+	assert.Equal(t, len(cmd.processes()), 0)
+
+	for _, p := range procs {
+		assert.Equal(t, alive(p.pid), false)
+	}
+}
+
+func TestCommand_StopEnvCleared(t *testing.T) {
+	cmd := NewCommand("sh")
+	cmd.Args = []string{"-c", "env -i setsid sleep 30 &"}
+
+	// the leader exits right away - the orphan has no marker, but it was reparented to imk.
+	assert.NoError(t, cmd.Execute(context.Background()))
+
+	procs := waitProcesses(t, cmd, 1)
+	assert.Equal(t, procs[0].name, "sleep")
+
+	cmd.Stop()
+
+	assert.Equal(t, alive(procs[0].pid), false)
+}
+
+func TestCommand_KillCancelledRun(t *testing.T) {
+	cmd := NewCommand("sleep 0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	assert.NoError(t, cmd.Execute(ctx))
+
+	cmd.Args = []string{"30"}
+
+	go cmd.Execute(context.Background())
+
+	procs := waitProcesses(t, cmd, 1)
+
+	// the finished run must not kill the one that followed.
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, alive(procs[0].pid), true)
+
+	cmd.Stop()
+	assert.Equal(t, alive(procs[0].pid), false)
+}
+
+func TestCommand_StopWhileStarting(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "slowexit.sh")
+	assert.NoError(t, os.WriteFile(script, []byte("trap 'sleep 1; exit 0' TERM\nwhile :; do sleep 0.1; done\n"), 0o600))
+
+	cmd := NewCommand("sh " + script)
+
+	go cmd.Execute(context.Background())
+	waitProcesses(t, cmd, 2)
+
+	first := runs.Load()
+
+	// the next run waits for the previous one to exit.
+	go cmd.Execute(context.Background())
+	time.Sleep(100 * time.Millisecond)
+
+	cmd.Stop()
+
+	assert.Equal(t, runs.Load(), first+1)
+	assert.Equal(t, len(children()), 0)
+}
+
+func waitProcesses(t *testing.T, cmd *Command, n int) []process {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+
+	for {
+		procs := cmd.processes()
+		if len(procs) == n {
+			return procs
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d processes, got %v", n, procs)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// alive reports whether the process is running - a zombie has exited already.
+func alive(pid int) bool {
+	fields := statFields(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	return len(fields) > 0 && !slices.Contains([]string{"Z", "X"}, fields[0])
+}
@@ -3,7 +3,10 @@ package command
 import (
 	"context"
 	"io"
+	"sync"
 	"time"
+
+	"go-imk/internal/limits"
 )
 
 type CommandRunner struct {
@@ -11,12 +14,12 @@ type CommandRunner struct {
 	secondaryCmd *Command
 
 	tearDownTimeout time.Duration
+	finishedAt      time.Time
 }
 
 func NewCommandRunner(
 	primaryCmd, secondaryCmd string,
 	tearDownTimeout time.Duration,
-	secondaryOutput io.Writer,
 ) *CommandRunner {
 	pCmd := NewCommand(primaryCmd)
 	if pCmd != nil {
@@ -24,8 +27,8 @@ func NewCommandRunner(
 	}
 
 	sCmd := NewCommand(secondaryCmd)
-	if sCmd != nil && secondaryOutput != nil {
-		sCmd = sCmd.WithTimeout(tearDownTimeout).WithOutput(secondaryOutput)
+	if sCmd != nil {
+		sCmd = sCmd.WithTimeout(tearDownTimeout)
 	}
 
 	return &CommandRunner{
@@ -35,10 +38,92 @@ func NewCommandRunner(
 	}
 }
 
+// WithPrimaryOutput sets the stdout and stderr destinations of the primary command.
+func (cr *CommandRunner) WithPrimaryOutput(out, errOut io.Writer) *CommandRunner {
+	if cr.primaryCmd != nil {
+		cr.primaryCmd = cr.primaryCmd.WithOutput(out).WithErrOutput(errOut)
+	}
+
+	return cr
+}
+
+// WithSecondaryOutput sets the stdout and stderr destinations of the secondary command.
+func (cr *CommandRunner) WithSecondaryOutput(out, errOut io.Writer) *CommandRunner {
+	if cr.secondaryCmd != nil {
+		cr.secondaryCmd = cr.secondaryCmd.WithOutput(out).WithErrOutput(errOut)
+	}
+
+	return cr
+}
+
+// WithSecondaryInput makes the secondary command read its stdin from the input.
+func (cr *CommandRunner) WithSecondaryInput(input *Input) *CommandRunner {
+	if cr.secondaryCmd != nil {
+		cr.secondaryCmd = cr.secondaryCmd.WithInput(input)
+	}
+
+	return cr
+}
+
+// WithSecondaryBeforeRun sets a hook that is called before every run of the secondary command.
+func (cr *CommandRunner) WithSecondaryBeforeRun(fn func() error) *CommandRunner {
+	if cr.secondaryCmd != nil {
+		cr.secondaryCmd = cr.secondaryCmd.WithBeforeRun(fn)
+	}
+
+	return cr
+}
+
+// WithDir sets the working directory of the commands.
+func (cr *CommandRunner) WithDir(dir string) *CommandRunner {
+	for _, cmd := range []*Command{cr.primaryCmd, cr.secondaryCmd} {
+		if cmd != nil {
+			cmd.WithDir(dir)
+		}
+	}
+
+	return cr
+}
+
+// WithEnv sets the function providing the variables added to the environment of the commands.
+func (cr *CommandRunner) WithEnv(env func() []string) *CommandRunner {
+	for _, cmd := range []*Command{cr.primaryCmd, cr.secondaryCmd} {
+		if cmd != nil {
+			cmd.WithEnv(env)
+		}
+	}
+
+	return cr
+}
+
+// WithPty makes the commands run under a pseudo-terminal.
+func (cr *CommandRunner) WithPty(enabled bool) *CommandRunner {
+	for _, cmd := range []*Command{cr.primaryCmd, cr.secondaryCmd} {
+		if cmd != nil {
+			cmd.WithPty(enabled)
+		}
+	}
+
+	return cr
+}
+
+// WithLimits restricts the resources available to every run of the commands.
+func (cr *CommandRunner) WithLimits(manager *limits.Manager) *CommandRunner {
+	for _, cmd := range []*Command{cr.primaryCmd, cr.secondaryCmd} {
+		if cmd != nil {
+			cmd.WithLimits(manager)
+		}
+	}
+
+	return cr
+}
+
 // Run the primary command. If the primary command have succeeded, it will execute the secondary
 // command. The command is run in a separate go routine and can be long running. In case it's
 // running, the command is killed and restarted.
 func (cr *CommandRunner) Run(ctx context.Context) error {
+	defer func() { cr.finishedAt = time.Now() }()
+
 	if err := cr.runPrimary(ctx); err != nil {
 		return err
 	}
@@ -48,6 +133,46 @@ func (cr *CommandRunner) Run(ctx context.Context) error {
 	return nil
 }
 
+// RestartSecondary restarts the secondary command if it has been started before (eg. after its
+// environment changed).
+func (cr *CommandRunner) RestartSecondary(ctx context.Context) {
+	if cr.secondaryCmd == nil || !cr.secondaryCmd.Started() {
+		return
+	}
+
+	cr.runSecondary(ctx)
+}
+
+// Stop kills the commands and waits for all the processes they started to exit (eg. before imk
+// exits).
+func (cr *CommandRunner) Stop() {
+	var wg sync.WaitGroup
+
+	for _, cmd := range []*Command{cr.primaryCmd, cr.secondaryCmd} {
+		if cmd != nil {
+			wg.Go(cmd.Stop)
+		}
+	}
+
+	wg.Wait()
+}
+
+// FinishedAt returns the time the last run finished (zero if there was no run yet). A run is
+// finished once the primary command exits and the secondary command is started.
+func (cr *CommandRunner) FinishedAt() time.Time {
+	return cr.finishedAt
+}
+
+// ExitCode returns the exit code of the last run of the primary command. If there is no primary
+// command, the run is considered successful.
+func (cr *CommandRunner) ExitCode() int {
+	if cr.primaryCmd == nil {
+		return 0
+	}
+
+	return cr.primaryCmd.ExitCode()
+}
+
 func (cr *CommandRunner) runPrimary(ctx context.Context) error {
 	if cr.primaryCmd == nil {
 		return nil
@@ -0,0 +1,63 @@
+package command
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-imk/test/assert"
+)
+
+func TestCommandRunner_RestartSecondary(t *testing.T) {
+	// the secondary command takes a while to exit once terminated.
+	script := filepath.Join(t.TempDir(), "slowexit.sh")
+	assert.NoError(t, os.WriteFile(script, []byte("trap 'sleep 1; exit 0' TERM\nwhile :; do sleep 0.1; done\n"), 0o600))
+
+	runner := NewCommandRunner("true", "sh "+script, 0)
+	defer runner.Stop()
+
+	ctx := context.Background()
+
+	// not started yet - nothing to restart.
+	runner.RestartSecondary(ctx)
+
+	first := runs.Load()
+
+	assert.NoError(t, runner.Run(ctx))
+	waitProcesses(t, runner.secondaryCmd, 2)
+
+	// the second restart comes while the first one waits for the secondary command to exit.
+	runner.RestartSecondary(ctx)
+	time.Sleep(200 * time.Millisecond)
+	runner.RestartSecondary(ctx)
+
+	// the primary command, the secondary command and its two restarts.
+	deadline := time.Now().Add(5 * time.Second)
+	for runs.Load() < first+4 || len(runner.secondaryCmd.processes()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the restarts (%d runs)", runs.Load()-first)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	assert.Equal(t, len(children()), 1)
+
+	runner.Stop()
+	assert.Equal(t, len(children()), 0)
+}
+
+// children returns the pids of the live child processes of the test.
+func children() []int {
+	var pids []int
+
+	for pid, stat := range readStats() {
+		if stat.ppid == os.Getpid() {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
@@ -0,0 +1,105 @@
+package command
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// Input forwards the data written to it to the stdin of the currently running command. The data
+// written while the command is not running is dropped. It is safe for concurrent use.
+type Input struct {
+	mu     sync.Mutex
+	w      io.WriteCloser
+	closed bool
+}
+
+func NewInput() *Input {
+	return &Input{}
+}
+
+// Write forwards the data to the running command. It blocks until the command reads the data, but
+// does not prevent the command from being restarted meanwhile.
+func (in *Input) Write(p []byte) (int, error) {
+	in.mu.Lock()
+	w := in.w
+	in.mu.Unlock()
+
+	if w == nil {
+		return len(p), nil
+	}
+
+	if _, err := w.Write(p); err != nil {
+		// the command has exited or closed its stdin - drop the input.
+		in.detach(w)
+	}
+
+	return len(p), nil
+}
+
+// Close closes the stdin of the running command, as well as of the commands started afterwards
+// (eg. once the input of imk is closed).
+func (in *Input) Close() error {
+	in.mu.Lock()
+	w := in.w
+	in.w = nil
+	in.closed = true
+	in.mu.Unlock()
+
+	if w == nil {
+		return nil
+	}
+
+	return w.Close()
+}
+
+func (in *Input) attach(w io.WriteCloser) {
+	in.mu.Lock()
+
+	if !in.closed {
+		in.w = w
+		in.mu.Unlock()
+
+		return
+	}
+
+	in.mu.Unlock()
+	_ = w.Close()
+}
+
+func (in *Input) detach(w io.WriteCloser) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if in.w == w {
+		in.w = nil
+	}
+}
+
+// ptyInput is the stdin of a command running under a pty. Closing it sends end-of-file instead
+// of closing the pty, which carries the output of the command as well.
+type ptyInput struct {
+	master  *os.File
+	partial bool // the last write did not end with a newline.
+}
+
+func (p *ptyInput) Write(data []byte) (int, error) {
+	n, err := p.master.Write(data)
+	if n > 0 {
+		p.partial = data[n-1] != '\n'
+	}
+
+	return n, err
+}
+
+// Close sends ^D - twice after a partial line, as the first one only flushes the line.
+func (p *ptyInput) Close() error {
+	eof := []byte{4}
+	if p.partial {
+		eof = append(eof, 4)
+	}
+
+	_, err := p.master.Write(eof)
+
+	return err
+}
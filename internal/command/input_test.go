@@ -0,0 +1,139 @@
+package command
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"go-imk/test/assert"
+)
+
+func TestInput_Write(t *testing.T) {
+	in := NewInput()
+
+	// not attached - dropped.
+	n, err := in.Write([]byte("lost\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, n, len("lost\n"))
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+
+	in.attach(w)
+	_, err = in.Write([]byte("one\n"))
+	assert.NoError(t, err)
+
+	in.detach(w)
+	_, err = in.Write([]byte("two\n"))
+	assert.NoError(t, err)
+
+	w.Close()
+
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), "one\n")
+}
+
+func TestInput_WriteBlocked(t *testing.T) {
+	in := NewInput()
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+
+	in.attach(w)
+
+	// the command does not read its input - the write blocks once the pipe is full.
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		_, _ = in.Write(make([]byte, 1<<20))
+	}()
+
+	detached := make(chan struct{})
+	go func() {
+		defer close(detached)
+		in.detach(w)
+	}()
+
+	select {
+	case <-detached:
+	case <-time.After(time.Second):
+		t.Fatal("detach blocked by the pending write")
+	}
+
+	w.Close() // as the command exits.
+	<-written
+}
+
+func TestInput_Close(t *testing.T) {
+	in := NewInput()
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r.Close()
+
+	in.attach(w)
+	assert.NoError(t, in.Close())
+
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), "")
+
+	// the commands started afterwards get end-of-file right away.
+	r2, w2, err := os.Pipe()
+	assert.NoError(t, err)
+	defer r2.Close()
+
+	in.attach(w2)
+
+	data, err = io.ReadAll(r2)
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), "")
+}
+
+func TestPtyInput_Close(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{
+			name: "should send end-of-file",
+			want: "\x04",
+		},
+		{
+			name:   "should send end-of-file after a line",
+			writes: []string{"one\n"},
+			want:   "one\n\x04",
+		},
+		{
+			name:   "should flush a partial line first",
+			writes: []string{"one"},
+			want:   "one\x04\x04",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			assert.NoError(t, err)
+			defer r.Close()
+
+			input := &ptyInput{master: w}
+			for _, data := range tt.writes {
+				_, err := input.Write([]byte(data))
+				assert.NoError(t, err)
+			}
+
+			assert.NoError(t, input.Close())
+			w.Close()
+
+			data, err := io.ReadAll(r)
+			assert.NoError(t, err)
+			assert.Equal(t, string(data), tt.want)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package command
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ptyDrainTimeout limits how long to wait for the output left in the pty after the command exits
+// (a background process may keep the pty open).
+const ptyDrainTimeout = 200 * time.Millisecond
+
+// ptySession connects a command to a new pseudo-terminal, so that the command sees a terminal
+// (eg. keeps the colours and progress bars) while its output is forwarded to the writer.
+type ptySession struct {
+	master *os.File
+	slave  *os.File
+
+	started bool
+	copied  chan struct{}
+	done    chan struct{}
+}
+
+// attachPty connects the output of the command to a new pty. The stdin is connected as well only
+// if the input is forwarded - otherwise it stays /dev/null, so that the commands reading it do not
+// wait for the input forever.
+func attachPty(cmd *exec.Cmd, input bool) (*ptySession, error) {
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Stdout, cmd.Stderr = slave, slave
+	if input {
+		cmd.Stdin = slave
+	}
+
+	cmd.SysProcAttr = ptyProcAttr()
+
+	return &ptySession{
+		master: master,
+		slave:  slave,
+		copied: make(chan struct{}),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// Started starts forwarding the output of the command and the window size changes once the
+// command is started.
+func (p *ptySession) Started(out io.Writer) {
+	p.started = true
+
+	// the command has its own copy - the master gets EIO once the command closes it.
+	p.slave.Close()
+
+	go func() {
+		defer close(p.copied)
+		_, _ = io.Copy(out, p.master)
+	}()
+
+	forwardResize(p.master, p.done)
+}
+
+// Close waits a little for the remaining output and closes the pty.
+func (p *ptySession) Close() {
+	close(p.done)
+
+	if p.started {
+		select {
+		case <-p.copied:
+		case <-time.After(ptyDrainTimeout):
+		}
+	}
+
+	p.master.Close()
+	p.slave.Close()
+
+	if p.started {
+		<-p.copied
+	}
+}
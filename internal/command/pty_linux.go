@@ -0,0 +1,133 @@
+//go:build linux
+
+package command
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultWinsize is used if imk itself does not run in a terminal.
+var defaultWinsize = unix.Winsize{Row: 24, Col: 80}
+
+// openPty opens a new pseudo-terminal and returns its master and slave ends. The slave does not
+// translate "\n" to "\r\n", so that the output is the same as with a pipe, and does not echo the
+// forwarded input (the terminal imk runs in already does).
+func openPty() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open pty > %w", err)
+	}
+
+	var name string
+
+	err = control(master, func(fd int) error {
+		if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+			return err
+		}
+
+		n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+		name = fmt.Sprintf("/dev/pts/%d", n)
+
+		return err
+	})
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("unable to unlock pty > %w", err)
+	}
+
+	slave, err := os.OpenFile(name, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("unable to open pty %s > %w", name, err)
+	}
+
+	err = control(slave, func(fd int) error {
+		termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+		if err != nil {
+			return err
+		}
+
+		termios.Oflag &^= unix.ONLCR
+		termios.Lflag &^= unix.ECHO
+
+		return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	})
+	if err != nil {
+		master.Close()
+		slave.Close()
+
+		return nil, nil, fmt.Errorf("unable to configure pty > %w", err)
+	}
+
+	resizePty(master)
+
+	return master, slave, nil
+}
+
+// ptyProcAttr makes the child the leader of a new session with the pty as its controlling
+// terminal. The session leader is also the leader of a new process group, so the group can be
+// killed the same way as without the pty.
+func ptyProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    1, // stdout of the child - stdin may be /dev/null.
+	}
+}
+
+// forwardResize copies the window size of the terminal imk runs in to the pty whenever it
+// changes, until done is closed. The kernel sends SIGWINCH to the processes on the pty.
+func forwardResize(master *os.File, done <-chan struct{}) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, unix.SIGWINCH)
+
+	go func() {
+		defer signal.Stop(sigCh)
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-sigCh:
+				resizePty(master)
+			}
+		}
+	}()
+}
+
+// resizePty sets the window size of the pty to the size of the terminal imk runs in.
+func resizePty(master *os.File) {
+	size := &defaultWinsize
+
+	for _, f := range []*os.File{os.Stdout, os.Stderr, os.Stdin} {
+		if ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ); err == nil {
+			size = ws
+			break
+		}
+	}
+
+	_ = control(master, func(fd int) error {
+		return unix.IoctlSetWinsize(fd, unix.TIOCSWINSZ, size)
+	})
+}
+
+// control runs fn with the file descriptor without switching the file to blocking mode (unlike
+// File.Fd), so that reads can still be interrupted by closing the file.
+func control(f *os.File, fn func(fd int) error) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var fnErr error
+	if err := conn.Control(func(fd uintptr) { fnErr = fn(int(fd)) }); err != nil {
+		return err
+	}
+
+	return fnErr
+}
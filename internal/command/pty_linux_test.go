@@ -0,0 +1,81 @@
+package command
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"go-imk/internal/reaper"
+	"go-imk/test/assert"
+)
+
+// runPty runs the shell script under a pty and returns its output.
+func runPty(t *testing.T, script string, input bool) string {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	cmd := exec.Command("sh", "-c", script)
+
+	pty, err := attachPty(cmd, input)
+	assert.NoError(t, err)
+
+	assert.NoError(t, reaper.Start(cmd))
+	pty.Started(&out)
+
+	assert.NoError(t, reaper.Wait(cmd))
+	pty.Close()
+
+	return out.String()
+}
+
+func TestAttachPty(t *testing.T) {
+	tests := []struct {
+		name  string
+		input bool
+		want  string
+	}{
+		{
+			name: "should keep stdin /dev/null without input",
+			want: "out tty\nin /dev/null\n",
+		},
+		{
+			name:  "should connect stdin with input",
+			input: true,
+			want:  "out tty\nin tty\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := `test -t 1 && echo out tty; test -t 0 && echo in tty || echo in $(readlink /proc/self/fd/0)`
+			assert.Equal(t, runPty(t, script, tt.input), tt.want)
+		})
+	}
+}
+
+func TestPtySession_CloseDrains(t *testing.T) {
+	out := runPty(t, "seq 1 20000", false)
+	assert.Equal(t, strings.Count(out, "\n"), 20000)
+}
+
+func TestPtySession_CloseBackground(t *testing.T) {
+	start := time.Now()
+
+	// the background process keeps the pty open.
+	out := runPty(t, "sleep 2 & echo done", false)
+	assert.Equal(t, out, "done\n")
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("close waited for the background process (%s)", elapsed)
+	}
+}
+
+func TestPtySession_CloseNotStarted(t *testing.T) {
+	pty, err := attachPty(exec.Command("true"), false)
+	assert.NoError(t, err)
+
+	pty.Close()
+}
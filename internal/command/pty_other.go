@@ -0,0 +1,21 @@
+//go:build !linux
+
+package command
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var errPtyUnsupported = errors.New("pty is only supported on Linux")
+
+func openPty() (*os.File, *os.File, error) {
+	return nil, nil, errPtyUnsupported
+}
+
+func ptyProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setpgid: true}
+}
+
+func forwardResize(*os.File, <-chan struct{}) {}
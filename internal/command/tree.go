@@ -0,0 +1,171 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go-imk/internal/limits"
+	"go-imk/internal/logger"
+)
+
+// runIDEnv marks every process started by a run of a command (the variable is inherited), so that
+// the processes that leave the process tree of the command can still be found and killed. imk
+// marks itself too, so that the processes of its own helpers (eg. git) are not taken for the ones
+// of a run.
+const runIDEnv = "IMK_RUN_ID"
+
+const (
+	// killGrace is how long the processes of a killed run have to exit before they get SIGKILL.
+	killGrace = 3 * time.Second
+
+	treeScanInterval = 50 * time.Millisecond
+
+	// trackInterval is how often the processes of a running command are recorded, so that they are
+	// known once they leave its process tree.
+	trackInterval = time.Second
+)
+
+var (
+	runs     atomic.Int64
+	markSelf sync.Once
+)
+
+type process struct {
+	pid  int
+	name string
+}
+
+func (p process) String() string {
+	return fmt.Sprintf("%s[%d]", p.name, p.pid)
+}
+
+// newRunID returns the value of runIDEnv for a new run.
+func newRunID() string {
+	markSelf.Do(func() {
+		_ = os.Setenv(runIDEnv, fmt.Sprintf("%d.0", os.Getpid()))
+	})
+
+	return fmt.Sprintf("%s=%d.%d", runIDEnv, os.Getpid(), runs.Add(1))
+}
+
+// tracker finds the processes of a run (Linux only) - the descendants of its leader, the
+// processes marked with its run ID and the orphans that were reparented to imk (the child
+// subreaper) after the run started and are not marked otherwise. The processes found once are
+// recognised later too, wherever they move.
+type tracker struct {
+	runID  string
+	leader int
+
+	mu    sync.Mutex
+	start uint64         // start time of the leader (clock ticks since boot).
+	seen  map[int]uint64 // start times of the processes found before by pid.
+}
+
+func newTracker(runID string, leader int) *tracker {
+	t := &tracker{runID: runID, leader: leader, seen: make(map[int]uint64)}
+	t.start = startTime(leader)
+
+	return t
+}
+
+// track records the processes of the run until done is closed.
+func (t *tracker) track(done <-chan struct{}) {
+	ticker := time.NewTicker(trackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			t.processes()
+		}
+	}
+}
+
+// processes returns the live processes of the last run of the command - the ones found by the
+// tracker and the ones in the cgroup of the run.
+func (c *Command) processes() []process {
+	c.mu.Lock()
+	tree, run := c.tree, c.run
+	c.mu.Unlock()
+
+	return runProcesses(tree, run)
+}
+
+func runProcesses(tree *tracker, run *limits.Run) []process {
+	var procs []process
+	if tree != nil {
+		procs = tree.processes()
+	}
+
+	if run != nil {
+		for _, pid := range run.Pids() {
+			if !slices.ContainsFunc(procs, func(p process) bool { return p.pid == pid }) {
+				procs = append(procs, process{pid: pid, name: processName(pid)})
+			}
+		}
+	}
+
+	return procs
+}
+
+// cleanUp waits for the processes of the last run to exit after Kill. The ones still alive after
+// killGrace are killed with SIGKILL and reported.
+func (c *Command) cleanUp() {
+	procs := c.waitExit(killGrace)
+	if len(procs) > 0 {
+		for _, p := range procs {
+			_ = syscall.Kill(p.pid, syscall.SIGKILL)
+		}
+
+		logger.Shoutf("killed %d processes that ignored SIGTERM [%s]: %s",
+			len(procs), c.String(), joinProcesses(procs))
+
+		if procs := c.waitExit(killGrace); len(procs) > 0 {
+			logger.Shoutf("unable to kill %d processes [%s]: %s",
+				len(procs), c.String(), joinProcesses(procs))
+		}
+	}
+
+	c.mu.Lock()
+	run := c.run
+	c.run = nil
+	c.mu.Unlock()
+
+	if run != nil {
+		if err := run.Close(); err != nil {
+			logger.Shoutf("error [%s]: %s", c.String(), err)
+		}
+	}
+}
+
+// waitExit waits up to the timeout for the processes of the last run to exit and returns the ones
+// still alive.
+func (c *Command) waitExit(timeout time.Duration) []process {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		procs := c.processes()
+		if len(procs) == 0 || time.Now().After(deadline) {
+			return procs
+		}
+
+		time.Sleep(treeScanInterval)
+	}
+}
+
+func joinProcesses(procs []process) string {
+	names := make([]string, 0, len(procs))
+	for _, p := range procs {
+		names = append(names, p.String())
+	}
+
+	return strings.Join(names, " ")
+}
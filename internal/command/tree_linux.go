@@ -0,0 +1,158 @@
+//go:build linux
+
+package command
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// procStat is the part of /proc/<pid>/stat needed to walk the process tree.
+type procStat struct {
+	ppid  int
+	start uint64
+}
+
+// processes returns the live processes of the run (see tracker) and records them.
+func (t *tracker) processes() []process {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := readStats()
+	self := os.Getpid()
+
+	// membership by pid - a process being checked counts as not a member (there are no cycles in
+	// the tree, but the processes may have moved while it was read).
+	member := make(map[int]bool)
+
+	var isMember func(pid int) bool
+	isMember = func(pid int) bool {
+		if m, ok := member[pid]; ok {
+			return m
+		}
+
+		member[pid] = false
+
+		stat := stats[pid]
+
+		m := false
+		if start, ok := t.seen[pid]; ok && start == stat.start {
+			m = true
+		} else if pid == t.leader && stat.start == t.start {
+			m = true
+		} else if _, ok := stats[stat.ppid]; ok && stat.ppid != self && isMember(stat.ppid) {
+			m = true
+		} else if mark, ok := runMark(pid); ok {
+			m = mark == t.runID
+		} else {
+			// an unmarked orphan (eg. started with env -i) - the runs are the only source of those.
+			m = stat.ppid == self && stat.start >= t.start
+		}
+
+		member[pid] = m
+
+		return m
+	}
+
+	var procs []process
+
+	seen := make(map[int]uint64)
+
+	for pid, stat := range stats {
+		if pid == self || !isMember(pid) {
+			continue
+		}
+
+		seen[pid] = stat.start
+		procs = append(procs, process{pid: pid, name: processName(pid)})
+	}
+
+	t.seen = seen
+
+	slices.SortFunc(procs, func(a, b process) int { return a.pid - b.pid })
+
+	return procs
+}
+
+// readStats reads the live processes - the zombies have exited already.
+func readStats() map[int]procStat {
+	paths, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return nil
+	}
+
+	stats := make(map[int]procStat, len(paths))
+
+	for _, path := range paths {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		if err != nil {
+			continue
+		}
+
+		fields := statFields(path)
+		if len(fields) < 20 || fields[0] == "Z" || fields[0] == "X" {
+			continue
+		}
+
+		ppid, _ := strconv.Atoi(fields[1])
+		start, _ := strconv.ParseUint(fields[19], 10, 64)
+
+		stats[pid] = procStat{ppid: ppid, start: start}
+	}
+
+	return stats
+}
+
+// statFields returns the fields of /proc/<pid>/stat after the command name (which may contain
+// spaces) - the state, the parent pid, ... and the start time as the 20th (see proc(5)).
+func statFields(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	stat := string(data)
+
+	return strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+}
+
+// startTime returns the start time of the process (0 if it is not running).
+func startTime(pid int) uint64 {
+	fields := statFields(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if len(fields) < 20 {
+		return 0
+	}
+
+	start, _ := strconv.ParseUint(fields[19], 10, 64)
+
+	return start
+}
+
+// runMark returns the runIDEnv variable of the process. The environment of the processes of other
+// users cannot be read (and they cannot be started by the commands).
+func runMark(pid int) (string, bool) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "environ"))
+	if err != nil {
+		return "", false
+	}
+
+	for variable := range strings.SplitSeq(string(data), "\x00") {
+		if strings.HasPrefix(variable, runIDEnv+"=") {
+			return variable, true
+		}
+	}
+
+	return "", false
+}
+
+func processName(pid int) string {
+	name, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return "?"
+	}
+
+	return strings.TrimSpace(string(name))
+}
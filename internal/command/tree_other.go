@@ -0,0 +1,16 @@
+//go:build !linux
+
+package command
+
+// processes is not supported - only the process group of the command is killed.
+func (t *tracker) processes() []process {
+	return nil
+}
+
+func startTime(int) uint64 {
+	return 0
+}
+
+func processName(int) string {
+	return "?"
+}
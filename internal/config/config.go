@@ -1,15 +1,25 @@
 package config
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
 
+	"go-imk/internal/filelist"
 	"go-imk/internal/fsops"
+	"go-imk/internal/git"
+	"go-imk/internal/limits"
+	"go-imk/internal/output"
+	"go-imk/internal/schedule"
 )
 
 var (
@@ -17,20 +27,84 @@ var (
 	ErrNoSecondaryCommand = errors.New("no secondary command specified")
 )
 
+const (
+	BackendAuto     = "auto"
+	BackendInotify  = "inotify"
+	BackendPoll     = "poll"
+	BackendFanotify = "fanotify"
+)
+
+const (
+	StdinToNone      = "none"
+	StdinToSecondary = "secondary"
+)
+
 type Config struct {
 	Files []string
 
+	Stdin   bool
+	NullSep bool
+	ListCmd string
+	Git     bool
+	VCS     bool
+
 	PrimaryCmd   string
 	SecondaryCmd string
 
-	TearDownTimeout time.Duration
+	Cwd     string
+	Env     []string
+	EnvFile string
+	Pty     bool
 
-	Recurse bool
-	OneRun  bool
-	RunNow  bool
+	StdinTo     string
+	StdinEscape string
 
-	OutFile string
+	Limits limits.Limits
 
+	TearDownTimeout time.Duration
+	Backend         string
+	PollInterval    time.Duration
+	PollFallback    bool
+	Every           time.Duration
+	Rate            float64
+	Cooldown        time.Duration
+	Burst           int
+	Cron            []string
+
+	Recurse        bool
+	FollowSymlinks bool
+	MaxDepth       int
+	Hidden         bool
+	Extensions     []string
+	OneRun         bool
+	RunNow         bool
+	Clear          bool
+	Hash           bool
+
+	Events   []string
+	EventOps fsops.Op
+
+	OutFile string
+	ErrFile string
+
+	Truncate   bool
+	RotateSize int64
+	RotateAge  time.Duration
+	RotateKeep int
+
+	Prefix       bool
+	PrefixNames  []string
+	PrefixColors []string
+	PrefixTime   bool
+
+	rotateSize string
+	limitMem   string
+	noHidden   bool
+	schedules  []schedule.Schedule
+	baseFiles  []string // the paths given as arguments or read from stdin
+	basePaths  []string // baseFiles with the sub-directories added by --recurse
+	listed     []string
+	repo       *git.Repo
 	version    string
 	fileWalker fsops.Walker
 }
@@ -47,28 +121,156 @@ func (c *Config) ParseCmdArgs() error {
 	pflag.BoolVarP(&version, "version", "v", false,
 		fmt.Sprintf("print version and exit. [%s]", c.version))
 
+	pflag.BoolVar(&c.Stdin, "stdin", false,
+		"read the list of files to watch from stdin (newline separated).")
+
+	pflag.BoolVarP(&c.NullSep, "null", "0", false,
+		"the lists of files read from stdin or --list-cmd are NUL separated.")
+
+	pflag.StringVar(&c.ListCmd, "list-cmd", "",
+		"shell command that prints the list of files to watch (eg. 'git ls-files') - "+
+			"re-run when a new file appears next to the watched ones.")
+
+	pflag.BoolVar(&c.Git, "git", false,
+		"watch the files tracked by git and the untracked files that are not ignored.")
+
+	pflag.BoolVar(&c.VCS, "vcs", false,
+		"recognise git operations (checkout, rebase, merge, pull), ignore the changes they make "+
+			"while in progress and run once afterwards.")
+
 	pflag.BoolVarP(&c.Recurse, "recurse", "r", false,
 		"if a directory is supplied, add all its sub-directories as well.")
 
+	pflag.BoolVar(&c.FollowSymlinks, "follow-symlinks", false,
+		"descend into symlinked directories when adding sub-directories.")
+
+	pflag.IntVar(&c.MaxDepth, "max-depth", -1,
+		"maximum depth of the sub-directories to add with --recurse (default - no limit).")
+
+	pflag.BoolVar(&c.Hidden, "hidden", true,
+		"add hidden sub-directories and react to changes of hidden files.")
+
+	pflag.BoolVar(&c.noHidden, "no-hidden", false,
+		"skip hidden sub-directories and ignore changes of hidden files (same as --hidden=false).")
+
+	pflag.StringSliceVar(&c.Extensions, "ext", nil,
+		"react only to changes of files with given extensions (eg. go,mod,sum).")
+
 	pflag.BoolVarP(&c.OneRun, "once", "n", false,
 		"run primary command once and exit on event.")
 
 	pflag.StringVarP(&c.OutFile, "output", "o", "",
-		"send the stdout of secondary command to a file.")
+		"send the stdout of secondary command to a file (alias --stdout).")
+
+	pflag.StringVarP(&c.ErrFile, "stderr", "e", "",
+		"send the stderr of secondary command to a file (may be the same file as --output).")
+
+	pflag.BoolVar(&c.Truncate, "truncate", false,
+		"truncate the output files before every run of secondary command.")
+
+	pflag.StringVar(&c.rotateSize, "rotate-size", "",
+		"rotate the output files when they exceed the given size (eg. 512K, 10M).")
+
+	pflag.DurationVar(&c.RotateAge, "rotate-age", 0,
+		"rotate the output files when they get older than the given duration.")
+
+	pflag.IntVar(&c.RotateKeep, "rotate-keep", 3,
+		"number of rotated output files to keep.")
 
 	pflag.BoolVarP(&c.RunNow, "immediate", "i", false,
 		"run commands immediately before watching for events.")
 
+	pflag.StringSliceVar(&c.Events, "events", []string{"create", "write", "rename"},
+		"file events that trigger the commands (create, write, remove, rename, chmod).")
+
+	pflag.StringVar(&c.Backend, "backend", BackendAuto,
+		"file watching backend (auto, inotify, poll, fanotify).")
+
+	pflag.DurationVar(&c.PollInterval, "poll", 0,
+		"poll the files for changes with the given interval instead of using inotify "+
+			"(polling is enabled automatically on network file systems).")
+
+	pflag.BoolVar(&c.PollFallback, "poll-fallback", false,
+		"poll the directories that cannot be watched because the inotify watch limit is reached.")
+
+	pflag.DurationVar(&c.Every, "every", 0,
+		"also run the commands periodically at the given interval (eg. 10m).")
+
+	pflag.StringArrayVar(&c.Cron, "cron", nil,
+		"also run the commands at the times given by the cron expression (eg. '0 3 * * *' or @hourly). "+
+			"Can be repeated.")
+
+	pflag.Float64Var(&c.Rate, "rate", 1,
+		"maximum number of runs per second triggered by events (eg. 0.2 - one run per 5 seconds, 0 - no limit).")
+
+	pflag.IntVar(&c.Burst, "burst", 1,
+		"number of runs allowed in quick succession before --rate applies.")
+
+	pflag.DurationVar(&c.Cooldown, "cooldown", 0,
+		"minimum time between the end of a run and the start of the next one (eg. 5s). "+
+			"The changes made meanwhile are processed in one run.")
+
+	pflag.BoolVar(&c.Hash, "hash", false,
+		"ignore writes that do not change the content of the file.")
+
+	pflag.BoolVar(&c.Clear, "clear", false,
+		"clear the terminal before each run (print a separator if not a terminal).")
+
 	pflag.StringVarP(&c.PrimaryCmd, "command", "c", "",
 		"primary command to execute when a file or a folder is modified.")
 
 	pflag.StringVarP(&c.SecondaryCmd, "run", "u", "",
 		"secondary command to execute if primary command succeeded - runs in background.")
 
+	pflag.StringVar(&c.Cwd, "cwd", "",
+		"working directory of the commands (default - the current directory).")
+
+	pflag.StringArrayVar(&c.Env, "env", nil,
+		"set an environment variable of the commands (KEY=VALUE). Can be repeated.")
+
+	pflag.StringVar(&c.EnvFile, "env-file", "",
+		"read the environment variables of the commands from the .env file - "+
+			"reloaded when the file changes (the secondary command is restarted).")
+
+	pflag.BoolVar(&c.Pty, "pty", false,
+		"run the commands under a pseudo-terminal to keep their colours and progress bars (Linux only).")
+
+	pflag.StringVar(&c.StdinTo, "stdin-to", StdinToNone,
+		"forward the input of imk to the given command (none, secondary). "+
+			"Lines starting with --stdin-escape are imk commands (eg. ~r to run the commands, ~? for help).")
+
+	pflag.StringVar(&c.StdinEscape, "stdin-escape", "~",
+		"prefix of the imk commands when forwarding the input (type it twice to send it to the command).")
+
+	pflag.StringVar(&c.limitMem, "limit-memory", "",
+		"maximum memory of each run of a command (eg. 512M, 2G).")
+
+	pflag.Float64Var(&c.Limits.CPU, "limit-cpu", 0,
+		"CPU quota of each run of a command in CPUs (eg. 1.5) - requires cgroup v2.")
+
+	pflag.IntVar(&c.Limits.Procs, "limit-procs", 0,
+		"maximum number of processes of each run of a command (per user without cgroup v2).")
+
+	pflag.IntVar(&c.Limits.Files, "limit-files", 0,
+		"maximum number of open files of each process of a command.")
+
 	pflag.DurationVarP(&c.TearDownTimeout, "timeout", "k", 0,
 		"timeout after which to kill the command subprocess (default - do not kill).")
 
+	pflag.BoolVar(&c.Prefix, "prefix", false,
+		"prefix each line of the commands output with the command name.")
+
+	pflag.StringSliceVar(&c.PrefixNames, "prefix-names", []string{"build", "server"},
+		"names of the primary and secondary commands used in the output prefix.")
+
+	pflag.StringSliceVar(&c.PrefixColors, "prefix-colors", []string{"cyan", "magenta"},
+		"colors of the primary and secondary command prefixes (none, red, green, yellow, blue, magenta, cyan, white).")
+
+	pflag.BoolVar(&c.PrefixTime, "prefix-time", false,
+		"add a timestamp to every prefixed output line.")
+
 	pflag.Usage = usage
+	pflag.CommandLine.SetNormalizeFunc(normalizeFlag)
 
 	if len(os.Args) < 2 {
 		pflag.Usage()
@@ -90,17 +292,241 @@ func (c *Config) ParseCmdArgs() error {
 		return fmt.Errorf("secondary command is not supported with -o flag")
 	}
 
-	c.Files = pflag.Args()
+	if err := c.validateBackend(); err != nil {
+		return err
+	}
 
-	if c.Recurse {
-		if err := c.EnrichFiles(); err != nil {
+	if c.noHidden {
+		c.Hidden = false
+	}
+
+	for i, ext := range c.Extensions {
+		c.Extensions[i] = strings.TrimPrefix(strings.TrimSpace(ext), ".")
+	}
+
+	if err := c.validateEvents(); err != nil {
+		return err
+	}
+
+	if err := c.validateSchedules(); err != nil {
+		return err
+	}
+
+	if err := c.validateEnv(); err != nil {
+		return err
+	}
+
+	if c.Rate < 0 {
+		return fmt.Errorf("invalid rate %g", c.Rate)
+	}
+
+	if c.Burst < 1 {
+		return fmt.Errorf("invalid burst %d", c.Burst)
+	}
+
+	if c.Cooldown < 0 {
+		return fmt.Errorf("invalid cooldown %s", c.Cooldown)
+	}
+
+	if err := c.validateLimits(); err != nil {
+		return err
+	}
+
+	if err := c.validatePrefix(); err != nil {
+		return err
+	}
+
+	if err := c.validateOutput(); err != nil {
+		return err
+	}
+
+	c.baseFiles = pflag.Args()
+
+	if c.Stdin {
+		files, err := filelist.Read(os.Stdin, c.listSeparator())
+		if err != nil {
 			return err
 		}
+
+		if len(files) == 0 {
+			return errors.New("no files to watch read from stdin")
+		}
+
+		c.baseFiles = append(c.baseFiles, files...)
+	}
+
+	if c.Git && c.ListCmd != "" {
+		return fmt.Errorf("--git and --list-cmd cannot be used together")
+	}
+
+	if c.Git || c.VCS {
+		repo, err := git.FindRepo(".")
+		switch {
+		case err == nil:
+			c.repo = repo
+		case c.Git:
+			return err
+		default:
+			c.VCS = false // not in a git repository - nothing to recognise.
+		}
+	}
+
+	basePaths, err := c.enrich(c.baseFiles)
+	if err != nil {
+		return err
+	}
+
+	c.basePaths = basePaths
+	c.Files = slices.Clone(basePaths)
+
+	if c.HasFileList() {
+		_, err := c.RefreshFileList(context.Background())
+		return err
 	}
 
 	return nil
 }
 
+// Roots returns the paths requested by the user (including the listed ones), without the
+// sub-directories added by --recurse.
+func (c *Config) Roots() []string {
+	return append(slices.Clone(c.baseFiles), c.listed...)
+}
+
+// HasFileList reports whether the files to watch are produced by a list command or git.
+func (c *Config) HasFileList() bool {
+	return c.ListCmd != "" || c.Git
+}
+
+// Repo returns the git repository of the current directory (nil unless --git or --vcs is used).
+func (c *Config) Repo() *git.Repo {
+	return c.repo
+}
+
+// RefreshFileList re-runs the list command (or re-reads the git index) and updates the files to
+// watch. It reports whether the list has changed.
+func (c *Config) RefreshFileList(ctx context.Context) (bool, error) {
+	var listed []string
+	var err error
+
+	if c.Git {
+		listed, err = c.repo.Files(".")
+	} else {
+		listed, err = filelist.FromCommand(ctx, c.ListCmd, c.listSeparator())
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	if len(listed) == 0 {
+		return false, errors.New("the list of files to watch is empty")
+	}
+
+	enriched, err := c.enrich(listed)
+	if err != nil {
+		return false, err
+	}
+
+	prev := c.Files
+	c.listed = listed
+	c.Files = append(slices.Clone(c.basePaths), enriched...)
+
+	return !slices.Equal(prev, c.Files), nil
+}
+
+// WatchPaths returns the paths to pass to the watcher. With a list command, the directories of
+// the listed files are watched instead, so that new files can be detected. With git, the index
+// and HEAD are watched as well to refresh the list. The git directory is watched to recognise
+// git operations.
+func (c *Config) WatchPaths() []string {
+	paths := slices.Clone(c.Files)
+
+	if c.HasFileList() {
+		paths = slices.Clone(c.basePaths)
+		for _, dir := range filelist.Dirs(c.listed) {
+			if !slices.Contains(paths, dir) {
+				paths = append(paths, dir)
+			}
+		}
+
+		paths = append(paths, c.RefreshPaths()...)
+	}
+
+	if c.VCS {
+		paths = append(paths, c.repo.GitDir)
+	}
+
+	if c.EnvFile != "" {
+		paths = append(paths, c.EnvFile)
+	}
+
+	return paths
+}
+
+// IsEnvFile reports whether the path is the --env-file.
+func (c *Config) IsEnvFile(path string) bool {
+	if c.EnvFile == "" {
+		return false
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	envFile, err := filepath.Abs(c.EnvFile)
+
+	return err == nil && abs == envFile
+}
+
+// RefreshPaths returns the paths which changes require the list of files to be refreshed.
+func (c *Config) RefreshPaths() []string {
+	if !c.Git {
+		return nil
+	}
+
+	return []string{c.repo.IndexPath(), c.repo.HeadPath()}
+}
+
+// IsRefreshPath reports whether a change of the path requires the list of files to be refreshed.
+func (c *Config) IsRefreshPath(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	return slices.Contains(c.RefreshPaths(), abs)
+}
+
+// enrich adds the sub-directories of the paths with --recurse.
+func (c *Config) enrich(paths []string) ([]string, error) {
+	// fanotify watches the whole file system, so there is no need to add sub-directories.
+	if !c.Recurse || c.Backend == BackendFanotify {
+		return paths, nil
+	}
+
+	withChildren := make([]string, 0, len(paths))
+	for _, path := range paths {
+		files, err := c.fileWalker.Walk(path, c.WalkOptions())
+		if err != nil {
+			return nil, err
+		}
+
+		withChildren = append(withChildren, files...)
+	}
+
+	return withChildren, nil
+}
+
+func (c *Config) listSeparator() byte {
+	if c.NullSep {
+		return 0
+	}
+
+	return '\n'
+}
+
 func (c *Config) String() string {
 	tokens := make([]string, 0)
 
@@ -116,10 +542,87 @@ func (c *Config) String() string {
 		tokens = append(tokens, fmt.Sprintf("timeout[%s]", c.TearDownTimeout.String()))
 	}
 
+	if c.Cwd != "" {
+		tokens = append(tokens, fmt.Sprintf("cwd[%s]", c.Cwd))
+	}
+
+	// only the names of the variables - the values may be secret.
+	if len(c.Env) > 0 {
+		names := make([]string, 0, len(c.Env))
+		for _, env := range c.Env {
+			name, _, _ := strings.Cut(env, "=")
+			names = append(names, name)
+		}
+
+		tokens = append(tokens, fmt.Sprintf("env[%s]", strings.Join(names, ",")))
+	}
+
+	if c.EnvFile != "" {
+		tokens = append(tokens, fmt.Sprintf("env-file[%s]", c.EnvFile))
+	}
+
+	if c.Pty {
+		tokens = append(tokens, "pty")
+	}
+
+	if c.StdinTo != StdinToNone {
+		tokens = append(tokens, fmt.Sprintf("stdin-to[%s]", c.StdinTo))
+	}
+
+	if !c.Limits.IsZero() {
+		tokens = append(tokens, fmt.Sprintf("limits[%s]", c.Limits))
+	}
+
+	tokens = append(tokens, fmt.Sprintf("events[%s]", c.EventOps))
+
+	if c.Backend != BackendAuto {
+		tokens = append(tokens, fmt.Sprintf("backend[%s]", c.Backend))
+	}
+
+	if c.PollInterval != 0 {
+		tokens = append(tokens, fmt.Sprintf("poll[%s]", c.PollInterval.String()))
+	}
+
+	if c.PollFallback {
+		tokens = append(tokens, "poll-fallback")
+	}
+
+	if c.Rate != 1 || c.Burst != 1 {
+		tokens = append(tokens, fmt.Sprintf("rate[%g/s burst %d]", c.Rate, c.Burst))
+	}
+
+	if c.Cooldown > 0 {
+		tokens = append(tokens, fmt.Sprintf("cooldown[%s]", c.Cooldown))
+	}
+
+	if c.Every > 0 {
+		tokens = append(tokens, fmt.Sprintf("every[%s]", c.Every))
+	}
+
+	for _, expr := range c.Cron {
+		tokens = append(tokens, fmt.Sprintf("cron[%s]", expr))
+	}
+
 	if c.Recurse {
 		tokens = append(tokens, "recurse")
 	}
 
+	if c.FollowSymlinks {
+		tokens = append(tokens, "follow-symlinks")
+	}
+
+	if c.MaxDepth >= 0 {
+		tokens = append(tokens, fmt.Sprintf("max-depth[%d]", c.MaxDepth))
+	}
+
+	if !c.Hidden {
+		tokens = append(tokens, "no-hidden")
+	}
+
+	if len(c.Extensions) > 0 {
+		tokens = append(tokens, fmt.Sprintf("ext[%s]", strings.Join(c.Extensions, ",")))
+	}
+
 	if c.OneRun {
 		tokens = append(tokens, "one-run")
 	}
@@ -128,6 +631,30 @@ func (c *Config) String() string {
 		tokens = append(tokens, "immediate")
 	}
 
+	if c.Clear {
+		tokens = append(tokens, "clear")
+	}
+
+	if c.Hash {
+		tokens = append(tokens, "hash")
+	}
+
+	if c.Prefix {
+		tokens = append(tokens, fmt.Sprintf("prefix[%s]", strings.Join(c.PrefixNames, ",")))
+	}
+
+	if c.ListCmd != "" {
+		tokens = append(tokens, fmt.Sprintf("list-cmd[%s]", c.ListCmd))
+	}
+
+	if c.Git {
+		tokens = append(tokens, "git")
+	}
+
+	if c.VCS {
+		tokens = append(tokens, "vcs")
+	}
+
 	if c.Files != nil {
 		tokens = append(tokens, fmt.Sprintf("files[%s]", strings.Join(c.Files, ",")))
 	}
@@ -135,22 +662,216 @@ func (c *Config) String() string {
 	return strings.Join(tokens, " ")
 }
 
-func (c *Config) EnrichFiles() error {
-	withChildren := make([]string, 0, len(c.Files))
-	for _, file := range c.Files {
-		files, err := c.fileWalker.Walk(file)
+// WalkOptions returns the options used to collect the sub-directories and to filter the events.
+func (c *Config) WalkOptions() fsops.WalkOptions {
+	return fsops.WalkOptions{
+		FollowSymlinks: c.FollowSymlinks,
+		MaxDepth:       c.MaxDepth,
+		Hidden:         c.Hidden,
+		Extensions:     c.Extensions,
+	}
+}
+
+func (c *Config) validateBackend() error {
+	switch c.Backend {
+	case BackendAuto, BackendInotify, BackendPoll, BackendFanotify:
+	default:
+		return fmt.Errorf("unsupported backend %q", c.Backend)
+	}
+
+	if c.PollInterval > 0 && c.Backend == BackendAuto {
+		c.Backend = BackendPoll
+	}
+
+	return nil
+}
+
+func (c *Config) validateEvents() error {
+	if len(c.Events) == 0 {
+		return fmt.Errorf("at least one event must be specified")
+	}
+
+	ops, err := fsops.ParseOp(strings.Join(c.Events, ","))
+	if err != nil {
+		return err
+	}
+
+	c.EventOps = ops
+
+	return nil
+}
+
+func (c *Config) validateSchedules() error {
+	if c.Every < 0 {
+		return fmt.Errorf("invalid interval %s", c.Every)
+	}
+
+	if c.Every > 0 {
+		c.schedules = append(c.schedules, schedule.Every(c.Every))
+	}
+
+	for _, expr := range c.Cron {
+		cron, err := schedule.ParseCron(expr)
 		if err != nil {
 			return err
 		}
 
-		withChildren = append(withChildren, files...)
+		c.schedules = append(c.schedules, cron)
+	}
+
+	return nil
+}
+
+// Schedules returns the schedules of the periodic runs.
+func (c *Config) Schedules() []schedule.Schedule {
+	return c.schedules
+}
+
+func (c *Config) validateEnv() error {
+	if c.Cwd != "" {
+		info, err := os.Stat(c.Cwd)
+		if err != nil {
+			return fmt.Errorf("invalid working directory > %w", err)
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("invalid working directory %s: not a directory", c.Cwd)
+		}
 	}
 
-	c.Files = withChildren
+	if c.Pty && runtime.GOOS != "linux" {
+		return fmt.Errorf("--pty is only supported on Linux")
+	}
+
+	switch c.StdinTo {
+	case StdinToNone:
+	case StdinToSecondary:
+		if c.SecondaryCmd == "" {
+			return fmt.Errorf("--stdin-to secondary requires the secondary command")
+		}
+
+		if c.Stdin {
+			return fmt.Errorf("--stdin-to cannot be used together with --stdin")
+		}
+
+		if c.StdinEscape == "" {
+			return fmt.Errorf("--stdin-escape must not be empty")
+		}
+	default:
+		return fmt.Errorf("unsupported --stdin-to %q", c.StdinTo)
+	}
+
+	for _, env := range c.Env {
+		if name, _, ok := strings.Cut(env, "="); !ok || name == "" {
+			return fmt.Errorf("invalid environment variable %q: expected KEY=VALUE", env)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateLimits() error {
+	if c.limitMem != "" {
+		size, err := parseSize(c.limitMem)
+		if err != nil {
+			return fmt.Errorf("invalid memory limit > %w", err)
+		}
+
+		c.Limits.Memory = size
+	}
+
+	if c.Limits.CPU < 0 || c.Limits.Procs < 0 || c.Limits.Files < 0 {
+		return fmt.Errorf("resource limits must not be negative")
+	}
+
+	if !c.Limits.IsZero() && runtime.GOOS != "linux" {
+		return fmt.Errorf("resource limits are only supported on Linux")
+	}
 
 	return nil
 }
 
+func (c *Config) validatePrefix() error {
+	if !c.Prefix {
+		return nil
+	}
+
+	if len(c.PrefixNames) != 2 {
+		return fmt.Errorf("prefix names must contain exactly 2 entries - primary and secondary")
+	}
+
+	if len(c.PrefixColors) != 2 {
+		return fmt.Errorf("prefix colors must contain exactly 2 entries - primary and secondary")
+	}
+
+	for _, color := range c.PrefixColors {
+		if err := output.ValidateColor(color); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateOutput() error {
+	if c.rotateSize != "" {
+		size, err := parseSize(c.rotateSize)
+		if err != nil {
+			return err
+		}
+
+		c.RotateSize = size
+	}
+
+	if c.RotateKeep < 0 {
+		return fmt.Errorf("invalid rotate keep %d", c.RotateKeep)
+	}
+
+	if c.OutFile != "" || c.ErrFile != "" {
+		return nil
+	}
+
+	if c.Truncate || c.RotateSize > 0 || c.RotateAge > 0 {
+		return fmt.Errorf("output truncation and rotation require --output or --stderr")
+	}
+
+	return nil
+}
+
+// parseSize parses a size in bytes with an optional K, M or G suffix.
+func parseSize(size string) (int64, error) {
+	value, multiplier := size, int64(1)
+
+	switch {
+	case strings.HasSuffix(size, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(size, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(size, "G"):
+		multiplier = 1 << 30
+	}
+
+	if multiplier > 1 {
+		value = size[:len(size)-1]
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", size)
+	}
+
+	return n * multiplier, nil
+}
+
+// normalizeFlag maps flag aliases to their canonical names.
+func normalizeFlag(_ *pflag.FlagSet, name string) pflag.NormalizedName {
+	if name == "stdout" {
+		name = "output"
+	}
+
+	return pflag.NormalizedName(name)
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 	pflag.PrintDefaults()
@@ -161,5 +882,13 @@ func usage() {
 	fmt.Println("  imk -rc 'go build ./...' src/")
 	fmt.Println("  imk -rc 'go build ./...' src/ -k 5m")
 	fmt.Println("  imk -ric 'go build ./...' -u 'go run ./...' src/")
+	fmt.Println("  git ls-files | imk --stdin -c 'go build ./...'")
+	fmt.Println("  imk --list-cmd 'fd -e go' -c 'go build ./...'")
+	fmt.Println("  imk --git -c 'go build ./...'")
+	fmt.Println("  imk -rc 'make cache' --every 10m src/")
+	fmt.Println("  imk -ric 'go build ./...' -u 'go run ./...' --env-file .env --env GOFLAGS=-race src/")
+	fmt.Println("  imk -rc 'go test ./...' --limit-memory 2G --limit-cpu 2 src/")
+	fmt.Println("  imk -ric 'go build ./...' -u 'go run ./...' -o app.log -e app.log --rotate-size 10M src/")
+	fmt.Println("  imk -ric 'go build ./...' -u 'go run ./...' --prefix --prefix-names build,api src/")
 	fmt.Println()
 }
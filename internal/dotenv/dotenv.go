@@ -0,0 +1,161 @@
+// Package dotenv reads the environment variables from .env files.
+package dotenv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Load reads the variables from the file. The values may refer to the variables defined earlier
+// in the file or in the environment of the process.
+func Load(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read env file > %w", err)
+	}
+	defer file.Close()
+
+	vars, err := Read(file, os.LookupEnv)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read env file %s > %w", path, err)
+	}
+
+	return vars, nil
+}
+
+// Read reads the KEY=VALUE lines and returns the variables in the same form. Empty lines and
+// lines starting with # are skipped, as well as the optional "export " prefix. Values can be:
+//   - unquoted - trailing " # comments" are removed and $VAR / ${VAR} are expanded,
+//   - single-quoted - taken literally,
+//   - double-quoted - \n, \t, \", \\ escapes are supported and variables are expanded (\$ is a
+//     literal $).
+//
+// The lookup function resolves the variables that are not defined in the file.
+func Read(r io.Reader, lookup func(string) (string, bool)) ([]string, error) {
+	defined := make(map[string]string)
+	vars := make([]string, 0)
+
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string {
+			if value, ok := defined[name]; ok {
+				return value
+			}
+
+			value, _ := lookup(name)
+
+			return value
+		})
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		text = strings.TrimPrefix(text, "export ")
+
+		key, value, ok := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid line %d: expected KEY=VALUE", line)
+		}
+
+		value, err := parseValue(strings.TrimSpace(value), expand)
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %d > %w", line, err)
+		}
+
+		defined[key] = value
+		vars = append(vars, key+"="+value)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return vars, nil
+}
+
+func parseValue(value string, expand func(string) string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '\'', '"':
+		end := closingQuote(value, quote)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected characters after the quoted value")
+		}
+
+		if quote == '\'' {
+			return value[1:end], nil
+		}
+
+		return expandQuoted(value[1:end], expand), nil
+	}
+
+	if idx := strings.Index(value, " #"); idx >= 0 {
+		value = strings.TrimSpace(value[:idx])
+	}
+
+	return expand(value), nil
+}
+
+// closingQuote returns the index of the closing quote, skipping the escaped ones in double-quoted
+// values.
+func closingQuote(value string, quote byte) int {
+	for i := 1; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && quote == '"':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+
+	return -1
+}
+
+// escapes are the characters following a backslash in double-quoted values and their values.
+var escapes = map[byte]string{'n': "\n", 't': "\t", '"': `"`, '\\': `\`, '$': "$"}
+
+// expandQuoted replaces the escapes of the double-quoted value and expands the variables in the
+// rest of it - the escaped characters are never part of a variable reference.
+func expandQuoted(value string, expand func(string) string) string {
+	var b strings.Builder
+
+	start := 0
+
+	for i := 0; i < len(value)-1; i++ {
+		if value[i] != '\\' {
+			continue
+		}
+
+		escaped, ok := escapes[value[i+1]]
+		if !ok {
+			continue
+		}
+
+		b.WriteString(expand(value[start:i]))
+		b.WriteString(escaped)
+
+		i++
+		start = i + 1
+	}
+
+	b.WriteString(expand(value[start:]))
+
+	return b.String()
+}
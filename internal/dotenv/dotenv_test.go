@@ -0,0 +1,70 @@
+package dotenv_test
+
+import (
+	"strings"
+	"testing"
+
+	"go-imk/internal/dotenv"
+	"go-imk/test/assert"
+)
+
+func TestRead(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "HOME" {
+			return "/home/user", true
+		}
+
+		return "", false
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "should read plain values and skip comments",
+			input: "# comment\n\nGOFLAGS=-mod=mod\nexport NODE_ENV=development # inline comment\nEMPTY=\n",
+			want:  []string{"GOFLAGS=-mod=mod", "NODE_ENV=development", "EMPTY="},
+		},
+		{
+			name:  "should handle quoted values",
+			input: "SINGLE='$HOME # not a comment'\nDOUBLE=\"line\\n\\\"quoted\\\"\" # comment\n",
+			want:  []string{"SINGLE=$HOME # not a comment", "DOUBLE=line\n\"quoted\""},
+		},
+		{
+			name:  "should expand variables",
+			input: "DIR=${HOME}/app\nBIN=$DIR/bin\nMISSING=x${NOPE}y\n",
+			want:  []string{"DIR=/home/user/app", "BIN=/home/user/app/bin", "MISSING=xy"},
+		},
+		{
+			name:  "should not expand escaped dollars in double quotes",
+			input: "PRICE=\"\\$HOME costs \\\\$HOME\"\nPATTERN=\"^\\${1}\"\n",
+			want:  []string{"PRICE=$HOME costs \\/home/user", "PATTERN=^${1}"},
+		},
+		{
+			name:    "should fail on lines without =",
+			input:   "GOFLAGS\n",
+			wantErr: true,
+		},
+		{
+			name:    "should fail on unterminated quotes",
+			input:   "A=\"abc\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars, err := dotenv.Read(strings.NewReader(tt.input), lookup)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Join(vars, "|"), strings.Join(tt.want, "|"))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Package filelist reads the lists of files to watch produced by other tools (eg. git ls-files,
+// fd or go list).
+package filelist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"go-imk/internal/reaper"
+)
+
+// Read reads the paths separated by sep (eg. '\n' or 0) from the reader. Empty entries are
+// skipped.
+func Read(r io.Reader, sep byte) ([]string, error) {
+	files := make([]string, 0)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(splitOn(sep))
+
+	for scanner.Scan() {
+		path := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(path) == "" {
+			continue
+		}
+
+		files = append(files, filepath.Clean(path))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read the list of files > %w", err)
+	}
+
+	return files, nil
+}
+
+// FromCommand runs the command with the shell and reads the paths from its output.
+func FromCommand(ctx context.Context, command string, sep byte) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+
+	//nolint:gosec // G204 - need to run the command.
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := reaper.Start(cmd)
+	if err == nil {
+		err = reaper.Wait(cmd)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to list files with [%s]: %s > %w",
+			command, strings.TrimSpace(stderr.String()), err)
+	}
+
+	return Read(&stdout, sep)
+}
+
+// Dirs returns the unique parent directories of the files.
+func Dirs(files []string) []string {
+	seen := make(map[string]bool)
+	dirs := make([]string, 0)
+
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	return dirs
+}
+
+func splitOn(sep byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+
+		if i := bytes.IndexByte(data, sep); i >= 0 {
+			return i + 1, data[:i], nil
+		}
+
+		if atEOF {
+			return len(data), data, nil
+		}
+
+		return 0, nil, nil
+	}
+}
@@ -0,0 +1,39 @@
+package filelist_test
+
+import (
+	"strings"
+	"testing"
+
+	"go-imk/internal/filelist"
+	"go-imk/test/assert"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		sep   byte
+		want  []string
+	}{
+		{
+			name:  "should read newline separated paths",
+			input: "a.go\n./src/b.go\r\n\nc.go",
+			sep:   '\n',
+			want:  []string{"a.go", "src/b.go", "c.go"},
+		},
+		{
+			name:  "should read NUL separated paths",
+			input: "a.go\x00with space.go\x00",
+			sep:   0,
+			want:  []string{"a.go", "with space.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := filelist.Read(strings.NewReader(tt.input), tt.sep)
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Join(files, "|"), strings.Join(tt.want, "|"))
+		})
+	}
+}
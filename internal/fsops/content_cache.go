@@ -0,0 +1,274 @@
+package fsops
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultContentCacheSize is the maximum number of files which content hashes are kept.
+const DefaultContentCacheSize = 4096
+
+// truncateSettle is how long to wait for the write that follows the truncation of a file that is
+// rewritten in place.
+const truncateSettle = 50 * time.Millisecond
+
+// contentCache keeps the content hashes of recently written files to detect writes that did not
+// actually change the content (eg. save-without-change or formatting an already formatted file).
+// The least recently used entries are evicted once the cache is full.
+type contentCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+
+	// the writes that truncated a file, held back until the write that usually follows (see Skip).
+	truncated map[string]*Event
+	settled   []*Event
+	ready     chan struct{}
+}
+
+type contentEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+	hash    [sha256.Size]byte
+}
+
+func newContentCache(maxEntries int) *contentCache {
+	return &contentCache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+		truncated:  make(map[string]*Event),
+		ready:      make(chan struct{}, 1),
+	}
+}
+
+// Skip reports whether the event should be dropped because it is a write that did not change the
+// content of the file. Other events only update the cache. A nil cache never skips events.
+//
+// The file may be being rewritten in place (truncate and write) - the write that truncated it is
+// held back for truncateSettle and reported by Settled only if the file is still empty then, so
+// that the rewrite is compared with the previous content.
+func (c *contentCache) Skip(event *Event) bool {
+	if c == nil {
+		return false
+	}
+
+	switch {
+	case event.Op.Has(OpRemove | OpRename):
+		c.Forget(event.Path)
+	case event.Op.Has(OpCreate):
+		c.Changed(event.Path)
+	case event.Op == OpWrite:
+		if c.hold(event) {
+			return true
+		}
+
+		return !c.Changed(event.Path)
+	}
+
+	return false
+}
+
+// Ready returns the channel signalled once there are settled events (see Settled). A nil cache
+// never signals.
+func (c *contentCache) Ready() <-chan struct{} {
+	if c == nil {
+		return nil
+	}
+
+	return c.ready
+}
+
+// Settled returns the held back writes of the files that were truncated and left empty.
+func (c *contentCache) Settled() []*Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	settled := c.settled
+	c.settled = nil
+
+	return settled
+}
+
+// hold holds the write back if it truncated the file known to have content.
+func (c *contentCache) hold(event *Event) bool {
+	info, err := os.Stat(event.Path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[event.Path]
+	if !ok || elem.Value.(*contentEntry).size == 0 {
+		return false
+	}
+
+	if _, ok := c.truncated[event.Path]; !ok {
+		time.AfterFunc(truncateSettle, func() { c.settle(event.Path) })
+	}
+
+	c.truncated[event.Path] = event
+
+	return true
+}
+
+// settle reports the held back write if the file is still empty - otherwise the write that
+// followed the truncation is compared with the previous content.
+func (c *contentCache) settle(path string) {
+	c.mu.Lock()
+	event := c.truncated[path]
+	delete(c.truncated, path)
+	c.mu.Unlock()
+
+	if info, err := os.Stat(path); err != nil || info.Size() > 0 || !c.Changed(path) {
+		return
+	}
+
+	c.mu.Lock()
+	c.settled = append(c.settled, event)
+	c.mu.Unlock()
+
+	select {
+	case c.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Prime hashes the watched files and the files in the watched directories, so that the first
+// write that does not change a file is recognised too. It stops once the cache is full.
+func (c *contentCache) Prime(paths []string) {
+	if c == nil {
+		return
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		files := []string{path}
+
+		if info.IsDir() {
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				continue
+			}
+
+			files = files[:0]
+
+			for _, entry := range entries {
+				if entry.Type().IsRegular() {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+
+		for _, file := range files {
+			if c.full() {
+				return
+			}
+
+			c.Changed(file)
+		}
+	}
+}
+
+// Changed reports whether the content of the file has changed since the previous call. Files
+// seen for the first time or files that cannot be read are always reported as changed.
+func (c *contentCache) Changed(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		c.Forget(path)
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entry *contentEntry
+	if elem, ok := c.entries[path]; ok {
+		entry = elem.Value.(*contentEntry)
+		c.order.MoveToFront(elem)
+
+		// fast path - the file was not touched since the last check.
+		if entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+			return false
+		}
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return true
+	}
+
+	if entry == nil {
+		c.add(&contentEntry{path: path, size: info.Size(), modTime: info.ModTime(), hash: hash})
+		return true
+	}
+
+	changed := entry.size != info.Size() || entry.hash != hash
+
+	entry.size = info.Size()
+	entry.modTime = info.ModTime()
+	entry.hash = hash
+
+	return changed
+}
+
+func (c *contentCache) full() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries) >= c.maxEntries
+}
+
+// Forget removes the file from the cache (eg. when it was removed).
+func (c *contentCache) Forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[path]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, path)
+	}
+}
+
+func (c *contentCache) add(entry *contentEntry) {
+	c.entries[entry.path] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*contentEntry).path)
+	}
+}
+
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+
+	file, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return sum, err
+	}
+
+	copy(sum[:], hash.Sum(nil))
+
+	return sum, nil
+}
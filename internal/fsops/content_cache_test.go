@@ -0,0 +1,91 @@
+package fsops
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-imk/test/assert"
+)
+
+func TestContentCache_Changed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(path, []byte("package main\n"), 0o644))
+
+	cache := newContentCache(DefaultContentCacheSize)
+	cache.Prime([]string{dir})
+
+	// the same content written again - not a change even right after the start.
+	touch(t, path, "package main\n")
+	assert.Equal(t, cache.Changed(path), false)
+
+	touch(t, path, "package main // changed\n")
+	assert.Equal(t, cache.Changed(path), true)
+
+	// truncated and left empty.
+	touch(t, path, "")
+	assert.Equal(t, cache.Changed(path), true)
+	assert.Equal(t, cache.Changed(path), false)
+}
+
+func TestContentCache_SkipRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	assert.NoError(t, os.WriteFile(path, []byte("package main\n"), 0o644))
+
+	cache := newContentCache(DefaultContentCacheSize)
+	cache.Prime([]string{path})
+
+	// truncated and rewritten with the same content - the truncation is held back.
+	touch(t, path, "")
+	assert.Equal(t, cache.Skip(&Event{Op: OpWrite, Path: path}), true)
+
+	touch(t, path, "package main\n")
+	assert.Equal(t, cache.Skip(&Event{Op: OpWrite, Path: path}), true)
+
+	time.Sleep(2 * truncateSettle)
+
+	select {
+	case <-cache.Ready():
+		t.Fatalf("unexpected settled events %v", cache.Settled())
+	default:
+	}
+}
+
+func TestContentCache_SkipTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	assert.NoError(t, os.WriteFile(path, []byte("package main\n"), 0o644))
+
+	cache := newContentCache(DefaultContentCacheSize)
+	cache.Prime([]string{path})
+
+	// truncated and left empty - reported once it settles.
+	touch(t, path, "")
+
+	event := &Event{Op: OpWrite, Path: path}
+	assert.Equal(t, cache.Skip(event), true)
+
+	select {
+	case <-cache.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("the truncation was not reported")
+	}
+
+	settled := cache.Settled()
+	assert.Equal(t, len(settled), 1)
+	assert.Equal(t, settled[0], event)
+}
+
+// touch writes the content and moves the modification time forward, so that the change is
+// visible even on file systems with a coarse timestamp granularity.
+func touch(t *testing.T, path, content string) {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	modTime := info.ModTime().Add(time.Second)
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
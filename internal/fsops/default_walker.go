@@ -1,11 +1,15 @@
 package fsops
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
+
+	"go-imk/internal/logger"
 )
 
 // TODO: Add parameter to configure more filters.
@@ -21,10 +25,16 @@ var ignoredDirs = []string{
 // DefaultWalker implements Walker interface
 var DefaultWalker = WalkerFunc(Walk)
 
-func Walk(path string) ([]string, error) {
+func Walk(path string, opts WalkOptions) ([]string, error) {
 	files := make([]string, 0)
 
 	pathInfo, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// the path will be watched once it is created.
+		files = append(files, path)
+		return files, nil
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("unable to stat the path > %w", err)
 	}
@@ -34,27 +44,90 @@ func Walk(path string) ([]string, error) {
 		return files, nil
 	}
 
-	err = filepath.Walk(path, func(path string, info fs.FileInfo, err error) error {
-		if err != nil {
-			return fmt.Errorf("unable to access the path > %w", err)
-		}
+	w := &dirWalker{
+		opts:    opts,
+		visited: make(map[fileID]bool),
+		files:   files,
+	}
 
-		if info.IsDir() {
-			if isIgnored(path) {
-				return filepath.SkipDir // skipping the dir
-			}
+	if err := w.walk(path, pathInfo, 0); err != nil {
+		return nil, fmt.Errorf("unable to walk the path %s > %w", path, err)
+	}
+
+	return w.files, nil
+}
+
+// fileID identifies a directory by its device and inode to detect symlink loops.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
 
-			files = append(files, path)
+type dirWalker struct {
+	opts    WalkOptions
+	visited map[fileID]bool
+	files   []string
+}
+
+func (w *dirWalker) walk(dir string, info fs.FileInfo, depth int) error {
+	if isIgnored(dir) {
+		return nil // skipping the dir
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		id := fileID{dev: uint64(stat.Dev), ino: stat.Ino} //nolint:unconvert // Dev is int32 on some platforms.
+		if w.visited[id] {
+			logger.Shoutf("%s has already been visited (symlink loop?) - skipping", dir)
+			return nil
 		}
 
+		w.visited[id] = true
+	}
+
+	w.files = append(w.files, dir)
+
+	if w.opts.MaxDepth >= 0 && depth >= w.opts.MaxDepth {
 		return nil
-	})
+	}
 
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return nil, fmt.Errorf("unable to walk the path %s > %w", path, err)
+		return fmt.Errorf("unable to access the path > %w", err)
+	}
+
+	for _, entry := range entries {
+		child := filepath.Join(dir, entry.Name())
+
+		if !w.opts.Hidden && isHidden(entry.Name()) {
+			continue
+		}
+
+		if !entry.IsDir() && (!w.opts.FollowSymlinks || entry.Type()&fs.ModeSymlink == 0) {
+			continue
+		}
+
+		// os.Stat resolves symlinks, so a symlinked directory is watched via its link path and
+		// the events are reported relative to the link rather than the target.
+		childInfo, err := os.Stat(child)
+		if err != nil {
+			if entry.Type()&fs.ModeSymlink != 0 {
+				logger.Shoutf("unable to resolve symlink %s :: %s", child, err.Error())
+				continue
+			}
+
+			return fmt.Errorf("unable to access the path > %w", err)
+		}
+
+		if !childInfo.IsDir() {
+			continue
+		}
+
+		if err := w.walk(child, childInfo, depth+1); err != nil {
+			return err
+		}
 	}
 
-	return files, nil
+	return nil
 }
 
 func isIgnored(path string) bool {
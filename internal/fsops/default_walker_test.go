@@ -0,0 +1,65 @@
+package fsops_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-imk/internal/fsops"
+	"go-imk/test/assert"
+)
+
+func TestWalk(t *testing.T) {
+	root := t.TempDir()
+
+	for _, dir := range []string{"src/pkg/deep", "src/.git/objects", "src/.idea", "ext/lib"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o700))
+	}
+
+	assert.NoError(t, os.Symlink(filepath.Join(root, "ext"), filepath.Join(root, "src", "ext")))
+	assert.NoError(t, os.Symlink(filepath.Join(root, "src"), filepath.Join(root, "ext", "lib", "loop")))
+
+	tests := []struct {
+		name string
+		opts fsops.WalkOptions
+		want []string
+	}{
+		{
+			name: "should skip symlinks and ignored dirs",
+			opts: fsops.WalkOptions{MaxDepth: -1, Hidden: true},
+			want: []string{"src", "src/.idea", "src/pkg", "src/pkg/deep"},
+		},
+		{
+			name: "should follow symlinks and stop at loops",
+			opts: fsops.WalkOptions{MaxDepth: -1, Hidden: true, FollowSymlinks: true},
+			want: []string{"src", "src/.idea", "src/ext", "src/ext/lib", "src/pkg", "src/pkg/deep"},
+		},
+		{
+			name: "should skip hidden dirs",
+			opts: fsops.WalkOptions{MaxDepth: -1},
+			want: []string{"src", "src/pkg", "src/pkg/deep"},
+		},
+		{
+			name: "should limit the depth",
+			opts: fsops.WalkOptions{MaxDepth: 1, Hidden: true},
+			want: []string{"src", "src/.idea", "src/pkg"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := fsops.Walk(filepath.Join(root, "src"), tt.opts)
+			assert.NoError(t, err)
+
+			got := make([]string, 0, len(files))
+			for _, file := range files {
+				rel, err := filepath.Rel(root, file)
+				assert.NoError(t, err)
+				got = append(got, rel)
+			}
+
+			assert.Equal(t, strings.Join(got, ","), strings.Join(tt.want, ","))
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package fsops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Op is a bitmask of file system operations. A single event may carry several operations
+// (eg. CREATE|WRITE).
+type Op uint32
+
+const (
+	OpCreate Op = 1 << iota
+	OpWrite
+	OpRemove
+	OpRename
+	OpChmod
+	// OpRescan is a synthetic operation reported when events were lost (eg. the inotify queue
+	// overflowed) and any of the watched files may have changed.
+	OpRescan
+	// OpTimer is a synthetic operation reported by the schedules (eg. --every) rather than by the
+	// file system.
+	OpTimer
+	// OpManual is a synthetic operation reported when the user asks for a run (eg. typing ~r).
+	OpManual
+
+	// OpSynthetic are the synthetic operations. They are not subject to the event filters.
+	OpSynthetic = OpRescan | OpTimer | OpManual
+)
+
+var opNames = []struct {
+	op   Op
+	name string
+}{
+	{OpCreate, "CREATE"},
+	{OpWrite, "WRITE"},
+	{OpRemove, "REMOVE"},
+	{OpRename, "RENAME"},
+	{OpChmod, "CHMOD"},
+	{OpRescan, "RESCAN"},
+	{OpTimer, "TIMER"},
+	{OpManual, "MANUAL"},
+}
+
+// ParseOp parses a case-insensitive operation name (eg. "write") or a combination of names
+// separated by "|" or ",".
+func ParseOp(name string) (Op, error) {
+	var op Op
+
+	for _, token := range strings.FieldsFunc(name, func(r rune) bool { return r == '|' || r == ',' }) {
+		token = strings.ToUpper(strings.TrimSpace(token))
+
+		found := false
+		for _, known := range opNames {
+			if known.name == token {
+				op |= known.op
+				found = true
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("unsupported event %q", strings.ToLower(token))
+		}
+	}
+
+	return op, nil
+}
+
+// Has reports whether the op contains any of the given operations.
+func (o Op) Has(op Op) bool {
+	return o&op != 0
+}
+
+func (o Op) String() string {
+	names := make([]string, 0, len(opNames))
+
+	for _, known := range opNames {
+		if o.Has(known.op) {
+			names = append(names, known.name)
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+type Event struct {
+	Op Op
+
+	// Path is the path of the file as watched (eg. relative to the current directory).
+	Path string
+	// AbsPath is the absolute path of the file.
+	AbsPath string
+	// RelPath is the path of the file relative to the requested root it belongs to ("." for the
+	// requested paths themselves).
+	RelPath string
+	// OldPath is the previous path of a file moved within the watched directories (inotify only).
+	OldPath string
+
+	// IsDir reports whether the path is a directory (for removed paths if the backend knows).
+	IsDir bool
+	Time  time.Time
+}
+
+// NewEvent creates an event for the path that belongs to the given root and fills in the file
+// metadata.
+func NewEvent(op Op, path, root string) *Event {
+	path = filepath.Clean(path)
+
+	event := &Event{
+		Op:      op,
+		Path:    path,
+		AbsPath: path,
+		RelPath: path,
+		Time:    time.Now(),
+	}
+
+	if abs, err := filepath.Abs(path); err == nil {
+		event.AbsPath = abs
+	}
+
+	if rel, err := filepath.Rel(root, path); err == nil {
+		event.RelPath = rel
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		event.IsDir = info.IsDir()
+	}
+
+	return event
+}
@@ -0,0 +1,126 @@
+package fsops_test
+
+import (
+	"testing"
+
+	"go-imk/internal/fsops"
+	"go-imk/test/assert"
+)
+
+func TestParseOp(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    fsops.Op
+		wantStr string
+		wantErr bool
+	}{
+		{
+			name:    "should parse single op",
+			input:   "write",
+			want:    fsops.OpWrite,
+			wantStr: "WRITE",
+		},
+		{
+			name:    "should parse combined ops",
+			input:   "CREATE|WRITE",
+			want:    fsops.OpCreate | fsops.OpWrite,
+			wantStr: "CREATE|WRITE",
+		},
+		{
+			name:    "should parse comma separated ops",
+			input:   "remove,chmod,rename",
+			want:    fsops.OpRemove | fsops.OpRename | fsops.OpChmod,
+			wantStr: "REMOVE|RENAME|CHMOD",
+		},
+		{
+			name:    "should return error on unknown op",
+			input:   "write,delete",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op, err := fsops.ParseOp(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, op, tt.want)
+			assert.Equal(t, op.String(), tt.wantStr)
+		})
+	}
+}
+
+func TestWalkOptions_Match(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  fsops.WalkOptions
+		event *fsops.Event
+		want  bool
+	}{
+		{
+			name:  "should pass any event without limits",
+			opts:  fsops.WalkOptions{MaxDepth: -1, Hidden: true},
+			event: &fsops.Event{Op: fsops.OpWrite, Path: "src/.idea/a/b.xml", RelPath: ".idea/a/b.xml"},
+			want:  true,
+		},
+		{
+			name:  "should drop hidden files",
+			opts:  fsops.WalkOptions{MaxDepth: -1},
+			event: &fsops.Event{Op: fsops.OpWrite, Path: "src/.main.go.swp", RelPath: ".main.go.swp"},
+			want:  false,
+		},
+		{
+			name:  "should drop files in hidden dirs",
+			opts:  fsops.WalkOptions{MaxDepth: -1},
+			event: &fsops.Event{Op: fsops.OpWrite, Path: "src/.idea/a.xml", RelPath: ".idea/a.xml"},
+			want:  false,
+		},
+		{
+			name:  "should drop too deep files",
+			opts:  fsops.WalkOptions{MaxDepth: 1, Hidden: true},
+			event: &fsops.Event{Op: fsops.OpWrite, Path: "src/a/b/c.go", RelPath: "a/b/c.go"},
+			want:  false,
+		},
+		{
+			name:  "should pass files within depth",
+			opts:  fsops.WalkOptions{MaxDepth: 1, Hidden: true},
+			event: &fsops.Event{Op: fsops.OpWrite, Path: "src/a/c.go", RelPath: "a/c.go"},
+			want:  true,
+		},
+		{
+			name:  "should pass matching extensions",
+			opts:  fsops.WalkOptions{MaxDepth: -1, Hidden: true, Extensions: []string{"go", "mod"}},
+			event: &fsops.Event{Op: fsops.OpWrite, Path: "go.mod", RelPath: "go.mod"},
+			want:  true,
+		},
+		{
+			name:  "should pass requested hidden files",
+			opts:  fsops.WalkOptions{MaxDepth: -1},
+			event: &fsops.Event{Op: fsops.OpWrite, Path: ".env", RelPath: "."},
+			want:  true,
+		},
+		{
+			name:  "should pass removed dirs regardless of extension",
+			opts:  fsops.WalkOptions{MaxDepth: -1, Hidden: true, Extensions: []string{"go"}},
+			event: &fsops.Event{Op: fsops.OpRemove, Path: "src/pkg", RelPath: "pkg", IsDir: true},
+			want:  true,
+		},
+		{
+			name:  "should drop other extensions",
+			opts:  fsops.WalkOptions{MaxDepth: -1, Hidden: true, Extensions: []string{"go", "mod"}},
+			event: &fsops.Event{Op: fsops.OpWrite, Path: "README.md", RelPath: "README.md"},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.opts.Match(tt.event), tt.want)
+		})
+	}
+}
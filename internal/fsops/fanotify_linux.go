@@ -0,0 +1,312 @@
+package fsops
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"go-imk/internal/logger"
+)
+
+const (
+	fanotifyEvents = unix.FAN_CREATE | unix.FAN_MODIFY | unix.FAN_DELETE | unix.FAN_ATTRIB |
+		unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO | unix.FAN_ONDIR
+
+	// size of struct fanotify_event_metadata.
+	fanotifyMetadataLen = 24
+	// size of struct fanotify_event_info_header + __kernel_fsid_t + struct file_handle header.
+	fanotifyFidHeaderLen = 4 + 8 + 8
+)
+
+func (f *FanotifyWatcher) Watch(ctx context.Context) (chan *Event, error) {
+	set, err := newWatchSet(f.files)
+	if err != nil {
+		return nil, err
+	}
+
+	// before the file systems are marked - a write hashed as the baseline would not be reported.
+	f.contentCache.Prime(f.files)
+
+	flags := uint(unix.FAN_CLASS_NOTIF | unix.FAN_CLOEXEC | unix.FAN_NONBLOCK | unix.FAN_REPORT_DFID_NAME)
+
+	fd, err := unix.FanotifyInit(flags, unix.O_RDONLY|unix.O_CLOEXEC)
+	switch {
+	case errors.Is(err, unix.EPERM):
+		return nil, fmt.Errorf("fanotify requires CAP_SYS_ADMIN (try running as root) > %w", err)
+	case errors.Is(err, unix.EINVAL):
+		return nil, fmt.Errorf("kernel does not support FAN_REPORT_DFID_NAME (Linux 5.9+ required) > %w", err)
+	case err != nil:
+		return nil, fmt.Errorf("unable to create fanotify watcher > %w", err)
+	}
+
+	file := os.NewFile(uintptr(fd), "fanotify")
+
+	mountFds, err := markFileSystems(fd, set.Dirs())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	paths := newPathMap(set)
+	events := make(chan *Event)
+
+	// the events read, before the content filter.
+	read := make(chan *Event)
+
+	go func() {
+		<-ctx.Done()
+		file.Close() // unblocks the pending read.
+	}()
+
+	go func() {
+		defer close(read)
+		defer closeFds(mountFds)
+
+		buf := make([]byte, 64*1024)
+
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				if ctx.Err() == nil {
+					f.setErr(fmt.Errorf("unable to read fanotify events > %w", err))
+				}
+
+				logger.Shout("shutting down fanotify watcher")
+
+				return
+			}
+
+			for _, raw := range parseEvents(buf[:n], mountFds) {
+				for _, ev := range f.convert(paths, raw) {
+					if !send(ctx, read, ev) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer close(events)
+
+		for {
+			select {
+			case ev, ok := <-read:
+				if !ok {
+					return
+				}
+
+				if f.contentCache.Skip(ev) {
+					continue
+				}
+
+				if !send(ctx, events, ev) {
+					return
+				}
+
+			case <-f.contentCache.Ready():
+				for _, ev := range f.contentCache.Settled() {
+					if !send(ctx, events, ev) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// markFileSystems marks the file systems the directories reside on and returns a directory fd for
+// each of them to resolve the file handles reported by fanotify.
+func markFileSystems(fd int, dirs []string) ([]int, error) {
+	mountFds := make([]int, 0, len(dirs))
+
+	for _, dir := range dirs {
+		err := unix.FanotifyMark(fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, fanotifyEvents, unix.AT_FDCWD, dir)
+		if err != nil {
+			closeFds(mountFds)
+			return nil, fmt.Errorf("unable to mark file system of %s > %w", dir, err)
+		}
+
+		mountFd, err := unix.Open(dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			closeFds(mountFds)
+			return nil, fmt.Errorf("unable to open %s > %w", dir, err)
+		}
+
+		mountFds = append(mountFds, mountFd)
+	}
+
+	return mountFds, nil
+}
+
+// fanotifyEvent is an event read from fanotify with the path resolved.
+type fanotifyEvent struct {
+	mask uint64
+	path string
+}
+
+func parseEvents(buf []byte, mountFds []int) []fanotifyEvent {
+	events := make([]fanotifyEvent, 0)
+
+	for len(buf) >= fanotifyMetadataLen {
+		eventLen := int(binary.NativeEndian.Uint32(buf[0:4]))
+		metadataLen := int(binary.NativeEndian.Uint16(buf[6:8]))
+		mask := binary.NativeEndian.Uint64(buf[8:16])
+		fd := int32(binary.NativeEndian.Uint32(buf[16:20]))
+
+		if buf[4] != unix.FANOTIFY_METADATA_VERSION || eventLen < metadataLen || eventLen > len(buf) {
+			logger.Shout("unexpected fanotify event format")
+			break
+		}
+
+		if fd >= 0 {
+			unix.Close(int(fd))
+		}
+
+		if mask&unix.FAN_Q_OVERFLOW != 0 {
+			events = append(events, fanotifyEvent{mask: mask})
+		} else if path, ok := resolveName(buf[metadataLen:eventLen], mountFds); ok {
+			events = append(events, fanotifyEvent{mask: mask, path: path})
+		}
+
+		buf = buf[eventLen:]
+	}
+
+	return events
+}
+
+// convert maps the event back to the requested paths and updates the pending paths - the same as
+// the inotify watcher does.
+func (f *FanotifyWatcher) convert(paths *pathMap, raw fanotifyEvent) []*Event {
+	if raw.mask&unix.FAN_Q_OVERFLOW != 0 {
+		return []*Event{{Op: OpRescan, Path: "*", Time: time.Now()}}
+	}
+
+	op := fanotifyOp(raw.mask)
+	events := make([]*Event, 0)
+
+	for _, path := range paths.Requested(raw.path) {
+		if op.Has(OpCreate) {
+			// the file system is marked as a whole, so there are no new watches to add.
+			_, appeared := paths.set.Resolve(path)
+			if len(appeared) > 0 {
+				paths.Refresh()
+			}
+
+			// the pending paths that appeared with one of their parents.
+			for _, p := range appeared {
+				if p != path {
+					root, _ := f.match(paths.set, p)
+					events = append(events, f.newEvent(OpCreate, p, root))
+				}
+			}
+		}
+
+		if op.Has(OpRemove) || op.Has(OpRename) {
+			if len(paths.set.Removed(path)) > 0 {
+				paths.Refresh()
+			}
+		}
+
+		if root, ok := f.match(paths.set, path); ok {
+			event := f.newEvent(op, path, root)
+			event.IsDir = event.IsDir || raw.mask&unix.FAN_ONDIR != 0
+
+			return append(events, event)
+		}
+	}
+
+	return events
+}
+
+// resolveName resolves the path from the FAN_EVENT_INFO_TYPE_DFID_NAME record - the handle of the
+// parent directory followed by the name of the file.
+func resolveName(info []byte, mountFds []int) (string, bool) {
+	for len(info) >= fanotifyFidHeaderLen {
+		infoType := info[0]
+		infoLen := int(binary.NativeEndian.Uint16(info[2:4]))
+
+		if infoLen < fanotifyFidHeaderLen || infoLen > len(info) {
+			return "", false
+		}
+
+		if infoType == unix.FAN_EVENT_INFO_TYPE_DFID_NAME {
+			handleLen := int(binary.NativeEndian.Uint32(info[12:16]))
+			handleType := int32(binary.NativeEndian.Uint32(info[16:20]))
+
+			if fanotifyFidHeaderLen+handleLen > infoLen {
+				return "", false
+			}
+
+			handle := unix.NewFileHandle(handleType, info[fanotifyFidHeaderLen:fanotifyFidHeaderLen+handleLen])
+			name := unix.ByteSliceToString(info[fanotifyFidHeaderLen+handleLen : infoLen])
+
+			dir, ok := resolveHandle(handle, mountFds)
+			if !ok {
+				return "", false
+			}
+
+			if name == "" || name == "." {
+				return dir, true
+			}
+
+			return filepath.Join(dir, name), true
+		}
+
+		info = info[infoLen:]
+	}
+
+	return "", false
+}
+
+func resolveHandle(handle unix.FileHandle, mountFds []int) (string, bool) {
+	for _, mountFd := range mountFds {
+		fd, err := unix.OpenByHandleAt(mountFd, handle, unix.O_PATH|unix.O_CLOEXEC)
+		if err != nil {
+			continue
+		}
+
+		path, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+		unix.Close(fd)
+
+		if err == nil {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+func fanotifyOp(mask uint64) Op {
+	var op Op
+
+	for from, to := range map[uint64]Op{
+		unix.FAN_CREATE:     OpCreate,
+		unix.FAN_MOVED_TO:   OpCreate,
+		unix.FAN_MODIFY:     OpWrite,
+		unix.FAN_DELETE:     OpRemove,
+		unix.FAN_MOVED_FROM: OpRename,
+		unix.FAN_ATTRIB:     OpChmod,
+	} {
+		if mask&from != 0 {
+			op |= to
+		}
+	}
+
+	return op
+}
+
+func closeFds(fds []int) {
+	for _, fd := range fds {
+		unix.Close(fd)
+	}
+}
@@ -0,0 +1,74 @@
+package fsops_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-imk/internal/fsops"
+	"go-imk/test/assert"
+)
+
+// watchFanotify starts the fanotify watcher or skips the test if fanotify is not available (it
+// requires CAP_SYS_ADMIN).
+func watchFanotify(t *testing.T, ctx context.Context, watcher *fsops.FanotifyWatcher) chan *fsops.Event {
+	t.Helper()
+
+	events, err := watcher.Watch(ctx)
+	if err != nil {
+		t.Skipf("fanotify is not available :: %s", err.Error())
+	}
+
+	return events
+}
+
+func TestFanotifyWatcher_WatchSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	link := filepath.Join(dir, "link")
+	assert.NoError(t, os.Mkdir(target, 0o700))
+	assert.NoError(t, os.Symlink(target, link))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := watchFanotify(t, ctx, fsops.NewFanotifyWatcher([]string{link}))
+
+	// reported by the kernel as target/main.go.
+	path := filepath.Join(link, "main.go")
+	assert.NoError(t, os.WriteFile(path, []byte("package main"), 0o600))
+
+	event := waitFor(t, events, fsops.OpCreate, path)
+	assert.Equal(t, event.RelPath, "main.go")
+}
+
+func TestFanotifyWatcher_WatchRelative(t *testing.T) {
+	dir := t.TempDir()
+	cwd := filepath.Join(dir, "cwd")
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "src"), 0o700))
+	assert.NoError(t, os.Mkdir(cwd, 0o700))
+	t.Chdir(cwd)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := watchFanotify(t, ctx, fsops.NewFanotifyWatcher([]string{"../src"}))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main"), 0o600))
+	waitFor(t, events, fsops.OpCreate, filepath.Join("..", "src", "main.go"))
+}
+
+func TestFanotifyWatcher_WatchMissing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gen", "file.txt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := watchFanotify(t, ctx, fsops.NewFanotifyWatcher([]string{path}))
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "gen"), 0o700))
+	assert.NoError(t, os.WriteFile(path, []byte("one"), 0o600))
+	waitFor(t, events, fsops.OpCreate, path)
+}
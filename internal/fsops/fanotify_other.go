@@ -0,0 +1,12 @@
+//go:build !linux
+
+package fsops
+
+import (
+	"context"
+	"errors"
+)
+
+func (f *FanotifyWatcher) Watch(ctx context.Context) (chan *Event, error) {
+	return nil, errors.New("fanotify backend is only supported on Linux")
+}
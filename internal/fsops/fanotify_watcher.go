@@ -0,0 +1,165 @@
+package fsops
+
+import (
+	"cmp"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// FanotifyWatcher is a Watcher based on fanotify marks on the whole file system the watched
+// paths reside on (Linux only). Unlike inotify, it does not need a watch per directory, which
+// makes it suitable for huge trees. The events are filtered to the requested paths. It requires
+// CAP_SYS_ADMIN and a kernel supporting FAN_REPORT_DFID_NAME (5.9+).
+type FanotifyWatcher struct {
+	watchBase
+
+	recurse bool
+
+	mu  sync.Mutex
+	err error
+}
+
+func NewFanotifyWatcher(files []string) *FanotifyWatcher {
+	return &FanotifyWatcher{
+		watchBase: watchBase{files: files},
+	}
+}
+
+// WithRecurse makes the watcher report the events from all the sub-directories of the watched
+// directories (except the ignored ones).
+func (f *FanotifyWatcher) WithRecurse(recurse bool) *FanotifyWatcher {
+	f.recurse = recurse
+	return f
+}
+
+// WithOptions sets the options shared by all the watchers.
+func (f *FanotifyWatcher) WithOptions(opts Options) *FanotifyWatcher {
+	f.setOptions(opts)
+	return f
+}
+
+// Err returns the error that stopped the watcher, if any.
+func (f *FanotifyWatcher) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+func (f *FanotifyWatcher) setErr(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.err = err
+}
+
+// match returns the watched root of the path if the path is one of the requested ones.
+func (f *FanotifyWatcher) match(set *watchSet, path string) (string, bool) {
+	if root, ok := set.Match(path); ok || !f.recurse {
+		return root, ok
+	}
+
+	for dir := range set.dirs {
+		if !strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			continue
+		}
+
+		// skip the ignored directories (eg. .git) between the root and the path.
+		if hasIgnoredDir(strings.TrimPrefix(filepath.Dir(path), dir)) {
+			continue
+		}
+
+		return dir, true
+	}
+
+	return "", false
+}
+
+// hasIgnoredDir reports whether any of the directories in the path is ignored.
+func hasIgnoredDir(path string) bool {
+	for ; len(path) > 1; path = filepath.Dir(path) {
+		if isIgnored(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pathMap maps the paths reported by the kernel back to the paths as requested. fanotify reports
+// absolute paths with the symlinks resolved, while the user may have requested relative paths,
+// paths outside the current directory or paths through symlinks.
+type pathMap struct {
+	set     *watchSet
+	aliases []alias
+}
+
+// alias is the canonical form of a requested path.
+type alias struct {
+	canonical string
+	requested string
+}
+
+func newPathMap(set *watchSet) *pathMap {
+	m := &pathMap{set: set}
+	m.Refresh()
+
+	return m
+}
+
+// Refresh updates the aliases after the requested paths have changed (eg. a pending path has
+// appeared).
+func (m *pathMap) Refresh() {
+	m.aliases = m.aliases[:0]
+
+	add := func(path string) {
+		canonical, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return
+		}
+
+		if canonical, err = filepath.Abs(canonical); err == nil {
+			m.aliases = append(m.aliases, alias{canonical: canonical, requested: path})
+		}
+	}
+
+	for dir := range m.set.dirs {
+		add(dir)
+	}
+
+	for file := range m.set.files {
+		// the file itself may be a symlink, while the new file of an atomic save is reported via
+		// the directory.
+		add(file)
+		add(filepath.Dir(file))
+	}
+
+	for path := range m.set.pending {
+		add(existingAncestor(path))
+	}
+
+	// the deepest aliases first.
+	slices.SortFunc(m.aliases, func(a, b alias) int {
+		return cmp.Compare(len(b.canonical), len(a.canonical))
+	})
+}
+
+// Requested returns the requested forms of the reported path.
+func (m *pathMap) Requested(path string) []string {
+	paths := make([]string, 0, 1)
+
+	for _, a := range m.aliases {
+		rel, ok := strings.CutPrefix(path, a.canonical)
+		if !ok || (rel != "" && rel[0] != filepath.Separator && a.canonical != string(filepath.Separator)) {
+			continue
+		}
+
+		if requested := filepath.Join(a.requested, rel); !slices.Contains(paths, requested) {
+			paths = append(paths, requested)
+		}
+	}
+
+	return paths
+}
@@ -2,7 +2,11 @@ package fsops
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"go-imk/internal/logger"
 
@@ -10,32 +14,94 @@ import (
 )
 
 type FileWatcher struct {
-	files []string
+	watchBase
+
+	pollFallback time.Duration
+
+	mu  sync.Mutex
+	err error
 }
 
 func NewFileWatcher(files []string) *FileWatcher {
 	return &FileWatcher{
-		files: files,
+		watchBase: watchBase{files: files},
 	}
 }
 
+// WithOptions sets the options shared by all the watchers.
+func (f *FileWatcher) WithOptions(opts Options) *FileWatcher {
+	f.setOptions(opts)
+	return f
+}
+
+// WithPollFallback makes the watcher poll the directories that could not be watched because the
+// inotify watch limit has been reached (0 - fail instead).
+func (f *FileWatcher) WithPollFallback(interval time.Duration) *FileWatcher {
+	f.pollFallback = interval
+	return f
+}
+
 func (f *FileWatcher) Watch(ctx context.Context) (chan *Event, error) {
-	watcher, err := fsnotify.NewWatcher()
+	set, err := newWatchSet(f.files)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create watcher > %w", err)
+		return nil, err
 	}
 
-	for _, file := range f.files {
-		if err := watcher.Add(file); err != nil {
-			return nil, fmt.Errorf("unable to watch file %s > %w", file, err)
-		}
+	// before the watches are added - a write hashed as the baseline would not be reported.
+	f.contentCache.Prime(f.files)
+
+	backend, err := f.newBackend(ctx, set)
+	if err != nil {
+		return nil, err
 	}
 
 	events := make(chan *Event)
 
 	go func() {
-		defer watcher.Close()
 		defer close(events)
+		defer func() { backend.Close() }()
+
+		// process handles the event of fsnotify. It reports whether the watcher should go on.
+		process := func(event fsnotify.Event, oldPath string) bool {
+			var appeared []string
+			if event.Has(fsnotify.Create) {
+				appeared = f.resolvePending(backend.watcher, set, event.Name)
+			}
+
+			// the pending paths that appeared with one of their parents (eg. a directory renamed
+			// into place).
+			for _, path := range appeared {
+				if path == filepath.Clean(event.Name) {
+					continue
+				}
+
+				root, _ := set.Match(path)
+				if !send(ctx, events, f.newEvent(OpCreate, path, root)) {
+					return false
+				}
+			}
+
+			root, ok := set.Match(event.Name)
+			wasDir := set.dirs[filepath.Clean(event.Name)] // unknown once removed.
+
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				f.addDirs(backend.watcher, set.Removed(event.Name))
+			}
+
+			if !ok {
+				return true
+			}
+
+			ev := f.newEvent(convertOp(event.Op), event.Name, root)
+			ev.OldPath = oldPath
+			ev.IsDir = ev.IsDir || wasDir
+
+			if f.contentCache.Skip(ev) {
+				return true
+			}
+
+			return send(ctx, events, ev)
+		}
 
 		for {
 			select {
@@ -43,18 +109,274 @@ func (f *FileWatcher) Watch(ctx context.Context) (chan *Event, error) {
 				logger.Shout("shutting down file watcher")
 				return
 
-			case event := <-watcher.Events:
-				events <- &Event{
-					Op:   event.Op.String(),
-					Path: event.Name,
+			case event, ok := <-backend.watcher.Events:
+				if !ok {
+					if backend, ok = f.recover(ctx, backend, set, fsnotify.ErrClosed); !ok {
+						return
+					}
+
+					continue
 				}
 
-			case err := <-watcher.Errors:
-				logger.Shoutf("watcher error :: %s", err.Error())
-				return
+				// the CREATE half of a move follows the RENAME half directly - it is read before the
+				// RENAME is sent on, so that a busy consumer does not break the pair.
+				oldPath := ""
+
+				for {
+					next, paired := nextRename(backend.watcher.Events, event)
+
+					if !process(event, oldPath) {
+						return
+					}
+
+					if !paired {
+						break
+					}
+
+					oldPath = ""
+					if next.Has(fsnotify.Create) {
+						oldPath = filepath.Clean(event.Name)
+					}
+
+					event = next
+				}
+
+			case ev, ok := <-backend.polled:
+				if !ok {
+					backend.polled = nil
+					continue
+				}
+
+				if !send(ctx, events, ev) {
+					return
+				}
+
+			case <-f.contentCache.Ready():
+				for _, ev := range f.contentCache.Settled() {
+					if !send(ctx, events, ev) {
+						return
+					}
+				}
+
+			case err, ok := <-backend.watcher.Errors:
+				if !ok {
+					err = fsnotify.ErrClosed
+				}
+
+				if errors.Is(err, fsnotify.ErrEventOverflow) {
+					// some events were lost - rescan the watched paths and trigger once.
+					logger.Shout("watcher queue overflow - rescanning")
+					f.rescan(backend.watcher, set)
+
+					if !send(ctx, events, &Event{Op: OpRescan, Path: "*", Time: time.Now()}) {
+						return
+					}
+
+					continue
+				}
+
+				if backend, ok = f.recover(ctx, backend, set, err); !ok {
+					return
+				}
 			}
 		}
 	}()
 
 	return events, nil
 }
+
+// Err returns the error that stopped the watcher, if any. It should be called after the events
+// channel is closed.
+func (f *FileWatcher) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+// backend is an fsnotify watcher together with the optional poller of the directories that
+// could not be watched by inotify.
+type backend struct {
+	watcher *fsnotify.Watcher
+	polled  chan *Event
+	cancel  context.CancelFunc
+}
+
+func (b *backend) Close() {
+	b.cancel()
+	b.watcher.Close()
+}
+
+// newNotifyWatcher creates the fsnotify watchers (replaced in tests).
+var newNotifyWatcher = fsnotify.NewWatcher
+
+func (f *FileWatcher) newBackend(ctx context.Context, set *watchSet) (*backend, error) {
+	watcher, err := newNotifyWatcher()
+	if err != nil {
+		return nil, instanceLimitError(err)
+	}
+
+	pollCtx, cancel := context.WithCancel(ctx)
+
+	polled, err := f.addWatches(pollCtx, watcher, set)
+	if err != nil {
+		cancel()
+		watcher.Close()
+
+		return nil, err
+	}
+
+	return &backend{
+		watcher: watcher,
+		polled:  polled,
+		cancel:  cancel,
+	}, nil
+}
+
+// recover re-creates the fsnotify watcher after an error. It retries a few times before giving
+// up and recording the error as fatal.
+func (f *FileWatcher) recover(ctx context.Context, old *backend, set *watchSet, cause error) (*backend, bool) {
+	const (
+		maxRetries = 3
+		retryDelay = time.Second
+	)
+
+	logger.Shoutf("watcher error :: %s - recreating the watcher", cause.Error())
+	old.Close()
+
+	var err error
+
+	for i := 0; i < maxRetries; i++ {
+		select {
+		case <-ctx.Done():
+			return old, false
+		case <-time.After(retryDelay):
+		}
+
+		var b *backend
+		if b, err = f.newBackend(ctx, set); err == nil {
+			return b, true
+		}
+
+		logger.Shoutf("unable to recreate the watcher (attempt %d/%d) :: %s", i+1, maxRetries, err.Error())
+	}
+
+	f.mu.Lock()
+	f.err = fmt.Errorf("watcher failed > %w", errors.Join(cause, err))
+	f.mu.Unlock()
+
+	return old, false
+}
+
+// rescan picks up the pending paths created meanwhile and re-adds the watches that may have
+// been lost.
+func (f *FileWatcher) rescan(watcher *fsnotify.Watcher, set *watchSet) {
+	f.addDirs(watcher, set.Rescan())
+}
+
+func send(ctx context.Context, events chan *Event, event *Event) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// addWatches adds the watched directories to the inotify watcher. If the inotify watch limit is
+// reached and the polling fallback is enabled, the remaining directories are polled instead and
+// their events are returned by the returned channel.
+func (f *FileWatcher) addWatches(ctx context.Context, watcher *fsnotify.Watcher, set *watchSet) (chan *Event, error) {
+	dirs := set.Dirs()
+
+	for i, dir := range dirs {
+		err := watcher.Add(dir)
+		if err == nil {
+			continue
+		}
+
+		if !isWatchLimitErr(err) {
+			return nil, fmt.Errorf("unable to watch file %s > %w", dir, err)
+		}
+
+		limitErr := watchLimitError(i, len(dirs), err)
+		if f.pollFallback <= 0 {
+			return nil, limitErr
+		}
+
+		logger.Shoutf("%s - polling the remaining %d directories", limitErr, len(dirs)-i)
+
+		paths := make([]string, 0)
+		for _, rest := range dirs[i:] {
+			paths = append(paths, set.Paths(rest)...)
+		}
+
+		poller := NewPollWatcher(paths, f.pollFallback)
+		poller.contentCache = f.contentCache
+		poller.roots = f.roots
+
+		return poller.Watch(ctx)
+	}
+
+	return nil, nil
+}
+
+// resolvePending adds watches for the pending (not yet existing) paths affected by the creation of
+// the given path - either the path itself has appeared or one of its missing parents has. The
+// pending paths that have appeared are returned.
+func (f *FileWatcher) resolvePending(watcher *fsnotify.Watcher, set *watchSet, created string) []string {
+	dirs, appeared := set.Resolve(created)
+	f.addDirs(watcher, dirs)
+
+	return appeared
+}
+
+func (f *FileWatcher) addDirs(watcher *fsnotify.Watcher, dirs []string) {
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			logger.Shoutf("unable to watch file %s :: %s", dir, err.Error())
+		}
+	}
+}
+
+func convertOp(op fsnotify.Op) Op {
+	var result Op
+
+	for from, to := range map[fsnotify.Op]Op{
+		fsnotify.Create: OpCreate,
+		fsnotify.Write:  OpWrite,
+		fsnotify.Remove: OpRemove,
+		fsnotify.Rename: OpRename,
+		fsnotify.Chmod:  OpChmod,
+	} {
+		if op.Has(from) {
+			result |= to
+		}
+	}
+
+	return result
+}
+
+// renamePairWindow is how long after a RENAME event is read the following event is waited for.
+// inotify queues both halves of a move within the watched directories together, so the CREATE
+// half is available right away.
+const renamePairWindow = 10 * time.Millisecond
+
+// nextRename reads the event following the RENAME event, if it arrives within renamePairWindow.
+// If it is a CREATE event, it is the other half of a move within the watched directories (fsnotify
+// pairs them using inotify cookies too, but does not expose the old path).
+func nextRename(events chan fsnotify.Event, event fsnotify.Event) (fsnotify.Event, bool) {
+	if !event.Has(fsnotify.Rename) {
+		return fsnotify.Event{}, false
+	}
+
+	timer := time.NewTimer(renamePairWindow)
+	defer timer.Stop()
+
+	select {
+	case next, ok := <-events:
+		return next, ok
+	case <-timer.C:
+		return fsnotify.Event{}, false
+	}
+}
@@ -0,0 +1,74 @@
+package fsops
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"go-imk/test/assert"
+)
+
+func TestFileWatcher_WatchRecover(t *testing.T) {
+	created := make(chan *fsnotify.Watcher, 4)
+
+	newNotifyWatcher = func() (*fsnotify.Watcher, error) {
+		watcher, err := fsnotify.NewWatcher()
+		if err == nil {
+			created <- watcher
+		}
+
+		return watcher, err
+	}
+	defer func() { newNotifyWatcher = fsnotify.NewWatcher }()
+
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := NewFileWatcher([]string{dir})
+
+	events, err := watcher.Watch(ctx)
+	assert.NoError(t, err)
+
+	// the watcher fails - it is recreated and the events keep coming.
+	(<-created).Errors <- errors.New("watcher failed")
+
+	select {
+	case <-created:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the watcher was not recreated")
+	}
+
+	// the file is written until its event arrives - the directory is watched again shortly after
+	// the watcher is recreated.
+	path := filepath.Join(dir, "main.go")
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	timeout := time.After(time.Second)
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("the watcher stopped: %v", watcher.Err())
+			}
+
+			if event.Path == path {
+				assert.NoError(t, watcher.Err())
+				return
+			}
+		case <-ticker.C:
+			assert.NoError(t, os.WriteFile(path, []byte("package main"), 0o600))
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", path)
+		}
+	}
+}
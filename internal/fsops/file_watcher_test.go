@@ -0,0 +1,244 @@
+package fsops_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-imk/internal/fsops"
+	"go-imk/test/assert"
+)
+
+func TestFileWatcher_WatchAtomicSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("one"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := fsops.NewFileWatcher([]string{path}).Watch(ctx)
+	assert.NoError(t, err)
+
+	for _, content := range []string{"two", "three"} {
+		tmp := filepath.Join(dir, "file.txt.tmp")
+		assert.NoError(t, os.WriteFile(tmp, []byte(content), 0o600))
+		assert.NoError(t, os.Rename(tmp, path))
+
+		select {
+		case event := <-events:
+			assert.Equal(t, event.Path, path)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func TestFileWatcher_WatchMissing(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gen", "sub", "file.txt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := fsops.NewFileWatcher([]string{path}).Watch(ctx)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "gen"), 0o700))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "gen", "sub"), 0o700))
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(path, []byte("one"), 0o600))
+
+	select {
+	case event := <-events:
+		assert.Equal(t, event.Op, fsops.OpCreate)
+		assert.Equal(t, event.Path, path)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+}
+
+func TestFileWatcher_WatchRecreatedDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "src")
+	assert.NoError(t, os.Mkdir(dir, 0o700))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := fsops.NewFileWatcher([]string{dir}).Watch(ctx)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Remove(dir))
+	waitFor(t, events, fsops.OpRemove, dir)
+
+	assert.NoError(t, os.Mkdir(dir, 0o700))
+	time.Sleep(50 * time.Millisecond)
+
+	path := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(path, []byte("package main"), 0o600))
+	waitFor(t, events, fsops.OpCreate, path)
+}
+
+func TestFileWatcher_WatchMissingRenamedIntoPlace(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gen", "file.txt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := fsops.NewFileWatcher([]string{path}).Watch(ctx)
+	assert.NoError(t, err)
+
+	// the directory is prepared elsewhere and renamed into place with the file inside.
+	tmp := filepath.Join(dir, "gen.tmp")
+	assert.NoError(t, os.Mkdir(tmp, 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(tmp, "file.txt"), []byte("one"), 0o600))
+	assert.NoError(t, os.Rename(tmp, filepath.Join(dir, "gen")))
+
+	waitFor(t, events, fsops.OpCreate, path)
+}
+
+func TestFileWatcher_WatchRelativeToRoot(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "pkg", "sub")
+	assert.NoError(t, os.MkdirAll(sub, 0o700))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the sub-directories as added by --recurse.
+	watcher := fsops.NewFileWatcher([]string{dir, filepath.Join(dir, "pkg"), sub}).
+		WithOptions(fsops.Options{Roots: []string{dir}})
+
+	events, err := watcher.Watch(ctx)
+	assert.NoError(t, err)
+
+	path := filepath.Join(sub, "main.go")
+	assert.NoError(t, os.WriteFile(path, []byte("package sub"), 0o600))
+
+	event := waitFor(t, events, fsops.OpCreate, path)
+	assert.Equal(t, event.RelPath, filepath.Join("pkg", "sub", "main.go"))
+}
+
+func TestFileWatcher_WatchRenamed(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.txt")
+	assert.NoError(t, os.WriteFile(oldPath, []byte("one"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := fsops.NewFileWatcher([]string{dir}).Watch(ctx)
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "new.txt")
+	assert.NoError(t, os.Rename(oldPath, path))
+
+	event := waitFor(t, events, fsops.OpCreate, path)
+	assert.Equal(t, event.OldPath, oldPath)
+}
+
+func TestFileWatcher_WatchRenamedBusy(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.txt")
+	assert.NoError(t, os.WriteFile(oldPath, []byte("one"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := fsops.NewFileWatcher([]string{dir}).Watch(ctx)
+	assert.NoError(t, err)
+
+	// the consumer is busy (eg. with a build) while the file is renamed.
+	path := filepath.Join(dir, "new.txt")
+	assert.NoError(t, os.Rename(oldPath, path))
+	time.Sleep(50 * time.Millisecond)
+
+	event := waitFor(t, events, fsops.OpRename, oldPath)
+	assert.Equal(t, event.OldPath, "")
+
+	time.Sleep(50 * time.Millisecond)
+
+	event = waitFor(t, events, fsops.OpCreate, path)
+	assert.Equal(t, event.OldPath, oldPath)
+}
+
+func TestFileWatcher_WatchRemovedDir(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "pkg")
+	assert.NoError(t, os.Mkdir(sub, 0o700))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := fsops.NewFileWatcher([]string{dir, sub}).Watch(ctx)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Remove(sub))
+
+	event := waitFor(t, events, fsops.OpRemove, sub)
+	assert.Equal(t, event.IsDir, true)
+}
+
+func TestFileWatcher_WatchRequestedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	assert.NoError(t, os.WriteFile(path, []byte("A=1"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := fsops.NewFileWatcher([]string{path}).WithOptions(fsops.Options{Roots: []string{path}})
+
+	events, err := watcher.Watch(ctx)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(path, []byte("A=2"), 0o600))
+
+	event := waitFor(t, events, fsops.OpWrite, path)
+	assert.Equal(t, event.RelPath, ".")
+	assert.Equal(t, fsops.WalkOptions{MaxDepth: -1}.Match(event), true)
+}
+
+func TestFileWatcher_WatchContentHash(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	assert.NoError(t, os.WriteFile(path, []byte("package main"), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	watcher := fsops.NewFileWatcher([]string{dir}).WithOptions(fsops.Options{ContentHash: true})
+
+	events, err := watcher.Watch(ctx)
+	assert.NoError(t, err)
+
+	// the first write right after the start is compared with the content the watch started with.
+	assert.NoError(t, os.WriteFile(path, []byte("package main // changed"), 0o600))
+	waitFor(t, events, fsops.OpWrite, path)
+
+	// truncated and left empty - reported once the truncation settles.
+	assert.NoError(t, os.Truncate(path, 0))
+	waitFor(t, events, fsops.OpWrite, path)
+}
+
+// waitFor waits for the event with the operation for the path, skipping the other events.
+func waitFor(t *testing.T, events chan *fsops.Event, op fsops.Op, path string) *fsops.Event {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+
+	for {
+		select {
+		case event := <-events:
+			if event.Op.Has(op) && event.Path == path {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s of %s", op, path)
+		}
+	}
+}
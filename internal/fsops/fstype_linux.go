@@ -0,0 +1,30 @@
+package fsops
+
+import "syscall"
+
+// File system magic numbers (see statfs(2)) of the file systems that do not deliver inotify
+// events for changes made by other hosts or by the hypervisor.
+var pollingFileSystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x65735546: "fuse",
+	0x786f4256: "vboxsf",
+	0x01021997: "9p",
+}
+
+// UnsupportedFS returns the name of the file system the path resides on if it is known not to
+// support inotify.
+func UnsupportedFS(path string) (string, bool) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return "", false
+	}
+
+	// Type is int32 on 32-bit archs - go through uint32 so that the magic numbers above 0x7fffffff
+	// are not sign-extended.
+	name, ok := pollingFileSystems[uint32(stat.Type)] //nolint:gosec // G115 - the magic is 32 bits.
+
+	return name, ok
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package fsops
+
+// UnsupportedFS returns the name of the file system the path resides on if it is known not to
+// support inotify.
+func UnsupportedFS(path string) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,80 @@
+package fsops
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MultiWatcher merges the events of several watchers (eg. the file watcher and the schedules).
+// It stops as soon as any of the watchers stops.
+type MultiWatcher struct {
+	watchers []Watcher
+}
+
+func NewMultiWatcher(watchers ...Watcher) *MultiWatcher {
+	return &MultiWatcher{
+		watchers: watchers,
+	}
+}
+
+func (m *MultiWatcher) Watch(ctx context.Context) (chan *Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	sources := make([]chan *Event, 0, len(m.watchers))
+
+	for _, watcher := range m.watchers {
+		source, err := watcher.Watch(ctx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		sources = append(sources, source)
+	}
+
+	events := make(chan *Event)
+	go m.merge(ctx, cancel, sources, events)
+
+	return events, nil
+}
+
+// merge forwards the events of the sources until any of them is closed.
+func (m *MultiWatcher) merge(ctx context.Context, cancel context.CancelFunc, sources []chan *Event, events chan *Event) {
+	defer close(events)
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	for _, source := range sources {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			defer cancel() // stop the other watchers as well.
+
+			for event := range source {
+				if !send(ctx, events, event) {
+					break
+				}
+			}
+
+			// drain the events sent before the watcher noticed the cancellation.
+			for range source {
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Err returns the errors of the watchers that failed.
+func (m *MultiWatcher) Err() error {
+	errs := make([]error, 0, len(m.watchers))
+
+	for _, watcher := range m.watchers {
+		errs = append(errs, watcher.Err())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,192 @@
+package fsops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"go-imk/internal/logger"
+)
+
+// DefaultPollInterval is used when polling is selected automatically.
+const DefaultPollInterval = 500 * time.Millisecond
+
+// PollWatcher is a Watcher that periodically scans the watched files and directories and compares
+// their mtime, size, mode and inode. It is used on file systems that do not deliver inotify
+// events (NFS, SSHFS, some Docker bind mounts, vboxsf shares).
+type PollWatcher struct {
+	watchBase
+
+	interval time.Duration
+}
+
+type fileState struct {
+	root    string
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+	inode   uint64
+}
+
+func NewPollWatcher(files []string, interval time.Duration) *PollWatcher {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	return &PollWatcher{
+		watchBase: watchBase{files: files},
+		interval:  interval,
+	}
+}
+
+// WithOptions sets the options shared by all the watchers.
+func (p *PollWatcher) WithOptions(opts Options) *PollWatcher {
+	p.setOptions(opts)
+	return p
+}
+
+func (p *PollWatcher) Watch(ctx context.Context) (chan *Event, error) {
+	for _, file := range p.files {
+		_, err := os.Stat(file)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// missing paths are picked up by the scan once they are created.
+			logger.Shoutf("%s does not exist - waiting for it to be created", file)
+		case err != nil:
+			return nil, fmt.Errorf("unable to watch file %s > %w", file, err)
+		}
+	}
+
+	p.contentCache.Prime(p.files)
+
+	events := make(chan *Event)
+	snapshot := p.scan()
+
+	go func() {
+		defer close(events)
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Shout("shutting down poll watcher")
+				return
+
+			case <-ticker.C:
+				current := p.scan()
+
+				for _, event := range diffSnapshots(snapshot, current) {
+					if p.contentCache.Skip(event) {
+						continue
+					}
+
+					if !send(ctx, events, event) {
+						return
+					}
+				}
+
+				snapshot = current
+
+			case <-p.contentCache.Ready():
+				for _, event := range p.contentCache.Settled() {
+					if !send(ctx, events, event) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// Err always returns nil - scan errors are not fatal for the poll watcher.
+func (p *PollWatcher) Err() error {
+	return nil
+}
+
+// scan collects the state of the watched files and the direct children of the watched
+// directories (same as inotify does for a watched directory).
+func (p *PollWatcher) scan() map[string]fileState {
+	snapshot := make(map[string]fileState)
+
+	for _, file := range p.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		if !info.IsDir() {
+			snapshot[filepath.Clean(file)] = newFileState(info, p.root(file, filepath.Dir(file)))
+			continue
+		}
+
+		snapshot[filepath.Clean(file)] = newFileState(info, p.root(file, file))
+
+		entries, err := os.ReadDir(file)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			path := filepath.Join(file, entry.Name())
+			snapshot[path] = newFileState(info, p.root(path, file))
+		}
+	}
+
+	return snapshot
+}
+
+func newFileState(info os.FileInfo, root string) fileState {
+	state := fileState{
+		root:    root,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		mode:    info.Mode(),
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		state.inode = stat.Ino
+	}
+
+	return state
+}
+
+func diffSnapshots(prev, current map[string]fileState) []*Event {
+	events := make([]*Event, 0)
+
+	for path, state := range current {
+		old, ok := prev[path]
+
+		switch {
+		case !ok, old.inode != state.inode:
+			events = append(events, NewEvent(OpCreate, path, state.root))
+		case !state.mode.IsDir() && (!old.modTime.Equal(state.modTime) || old.size != state.size):
+			events = append(events, NewEvent(OpWrite, path, state.root))
+		case old.mode != state.mode:
+			events = append(events, NewEvent(OpChmod, path, state.root))
+		}
+	}
+
+	for path, state := range prev {
+		if _, ok := current[path]; !ok {
+			event := NewEvent(OpRemove, path, state.root)
+			event.IsDir = state.mode.IsDir()
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,69 @@
+package fsops_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-imk/internal/fsops"
+	"go-imk/test/assert"
+)
+
+func TestPollWatcher_Watch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := fsops.NewPollWatcher([]string{dir}, 10*time.Millisecond).Watch(ctx)
+	assert.NoError(t, err)
+
+	next := func() *fsops.Event {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for event")
+			return nil
+		}
+	}
+
+	assert.NoError(t, os.WriteFile(path, []byte("one"), 0o600))
+	event := next()
+	assert.Equal(t, event.Op, fsops.OpCreate)
+	assert.Equal(t, event.Path, path)
+
+	assert.NoError(t, os.WriteFile(path, []byte("three"), 0o600))
+	event = next()
+	assert.Equal(t, event.Op, fsops.OpWrite)
+	assert.Equal(t, event.Path, path)
+
+	assert.NoError(t, os.Remove(path))
+	event = next()
+	assert.Equal(t, event.Op, fsops.OpRemove)
+	assert.Equal(t, event.Path, path)
+}
+
+func TestPollWatcher_WatchMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gen", "file.txt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := fsops.NewPollWatcher([]string{path}, 10*time.Millisecond).Watch(ctx)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+	assert.NoError(t, os.WriteFile(path, []byte("one"), 0o600))
+
+	select {
+	case event := <-events:
+		assert.Equal(t, event.Op, fsops.OpCreate)
+		assert.Equal(t, event.Path, path)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+}
@@ -1,13 +1,76 @@
 package fsops
 
+import (
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
 //go:generate moq -rm -fmt goimports -out walker_mock.go . Walker
 
+// WalkOptions configures which sub-directories are collected by a Walker. The same options are
+// used to filter the events, so that both are consistent.
+type WalkOptions struct {
+	// FollowSymlinks makes the walker descend into symlinked directories.
+	FollowSymlinks bool
+	// MaxDepth limits the depth of the sub-directories relative to the root (negative - no limit).
+	MaxDepth int
+	// Hidden makes the walker include hidden (dot) directories and the filter pass hidden files.
+	Hidden bool
+	// Extensions limits the events to the files with given extensions (empty - no limit).
+	Extensions []string
+}
+
+// Match reports whether the event passes the filters of the options. The event path relative to
+// its requested root is checked - the requested paths themselves (eg. an explicitly listed .env)
+// always pass. The extensions are not checked for directories.
+func (o WalkOptions) Match(event *Event) bool {
+	if event.Op.Has(OpSynthetic) || event.RelPath == "." {
+		return true
+	}
+
+	rel := filepath.ToSlash(event.RelPath)
+	dir := path.Dir(rel)
+
+	if o.MaxDepth >= 0 && dir != "." && strings.Count(dir, "/")+1 > o.MaxDepth {
+		return false
+	}
+
+	if !o.Hidden && hasHiddenPart(rel) {
+		return false
+	}
+
+	if len(o.Extensions) == 0 || event.IsDir {
+		return true
+	}
+
+	ext := strings.TrimPrefix(filepath.Ext(event.Path), ".")
+
+	return slices.Contains(o.Extensions, ext)
+}
+
+// hasHiddenPart reports whether any part of the slash separated path is hidden.
+func hasHiddenPart(rel string) bool {
+	for _, part := range strings.Split(rel, "/") {
+		if isHidden(part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
 type Walker interface {
-	Walk(path string) ([]string, error)
+	Walk(path string, opts WalkOptions) ([]string, error)
 }
 
-type WalkerFunc func(path string) ([]string, error)
+type WalkerFunc func(path string, opts WalkOptions) ([]string, error)
 
-func (w WalkerFunc) Walk(path string) ([]string, error) {
-	return w(path)
+func (w WalkerFunc) Walk(path string, opts WalkOptions) ([]string, error) {
+	return w(path, opts)
 }
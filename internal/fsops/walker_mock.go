@@ -17,7 +17,7 @@ var _ Walker = &WalkerMock{}
 //
 //		// make and configure a mocked Walker
 //		mockedWalker := &WalkerMock{
-//			WalkFunc: func(path string) ([]string, error) {
+//			WalkFunc: func(path string, opts WalkOptions) ([]string, error) {
 //				panic("mock out the Walk method")
 //			},
 //		}
@@ -28,7 +28,7 @@ var _ Walker = &WalkerMock{}
 //	}
 type WalkerMock struct {
 	// WalkFunc mocks the Walk method.
-	WalkFunc func(path string) ([]string, error)
+	WalkFunc func(path string, opts WalkOptions) ([]string, error)
 
 	// calls tracks calls to the methods.
 	calls struct {
@@ -36,25 +36,29 @@ type WalkerMock struct {
 		Walk []struct {
 			// Path is the path argument value.
 			Path string
+			// Opts is the opts argument value.
+			Opts WalkOptions
 		}
 	}
 	lockWalk sync.RWMutex
 }
 
 // Walk calls WalkFunc.
-func (mock *WalkerMock) Walk(path string) ([]string, error) {
+func (mock *WalkerMock) Walk(path string, opts WalkOptions) ([]string, error) {
 	if mock.WalkFunc == nil {
 		panic("WalkerMock.WalkFunc: method is nil but Walker.Walk was just called")
 	}
 	callInfo := struct {
 		Path string
+		Opts WalkOptions
 	}{
 		Path: path,
+		Opts: opts,
 	}
 	mock.lockWalk.Lock()
 	mock.calls.Walk = append(mock.calls.Walk, callInfo)
 	mock.lockWalk.Unlock()
-	return mock.WalkFunc(path)
+	return mock.WalkFunc(path, opts)
 }
 
 // WalkCalls gets all the calls that were made to Walk.
@@ -63,9 +67,11 @@ func (mock *WalkerMock) Walk(path string) ([]string, error) {
 //	len(mockedWalker.WalkCalls())
 func (mock *WalkerMock) WalkCalls() []struct {
 	Path string
+	Opts WalkOptions
 } {
 	var calls []struct {
 		Path string
+		Opts WalkOptions
 	}
 	mock.lockWalk.RLock()
 	calls = mock.calls.Walk
@@ -0,0 +1,63 @@
+package fsops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	maxUserWatchesPath   = "/proc/sys/fs/inotify/max_user_watches"
+	maxUserInstancesPath = "/proc/sys/fs/inotify/max_user_instances"
+	recommendedWatches   = 524288
+	recommendedInstances = 1024
+)
+
+// ErrWatchLimit is returned when the inotify watch limit (fs.inotify.max_user_watches) or the
+// limit of inotify instances (fs.inotify.max_user_instances) is exhausted.
+var ErrWatchLimit = errors.New("inotify watch limit reached")
+
+func isWatchLimitErr(err error) bool {
+	return errors.Is(err, syscall.ENOSPC)
+}
+
+// watchLimitError describes the exhausted watch limit along with the sysctl remedy.
+func watchLimitError(added, requested int, err error) error {
+	return fmt.Errorf("%w after %d of %d directories%s > %w", ErrWatchLimit, added, requested,
+		remedy("fs.inotify.max_user_watches", maxUserWatchesPath, recommendedWatches), err)
+}
+
+// instanceLimitError describes the error of creating an inotify instance. EMFILE is returned when
+// either the inotify instances of the user or the open files of imk are exhausted.
+func instanceLimitError(err error) error {
+	if !errors.Is(err, syscall.EMFILE) {
+		return fmt.Errorf("unable to create watcher > %w", err)
+	}
+
+	return fmt.Errorf("%w - too many inotify instances or open files%s "+
+		"or raise the open files limit (ulimit -n) > %w", ErrWatchLimit,
+		remedy("fs.inotify.max_user_instances", maxUserInstancesPath, recommendedInstances), err)
+}
+
+// remedy returns the current value of the inotify limit with the sysctl command to raise it.
+func remedy(name, path string, recommended int) string {
+	limit, err := readLimit(path)
+	if err != nil {
+		return fmt.Sprintf(" - increase the limit with 'sudo sysctl %s=%d'", name, recommended)
+	}
+
+	return fmt.Sprintf(" (%s = %d) - increase the limit with 'sudo sysctl %s=%d'",
+		name, limit, name, max(recommended, limit*2))
+}
+
+func readLimit(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
@@ -0,0 +1,44 @@
+package fsops
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"testing"
+
+	"go-imk/test/assert"
+)
+
+func TestWatchLimitError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		remedy string
+	}{
+		{
+			name:   "should tell how to raise the watch limit",
+			err:    watchLimitError(10, 20, fmt.Errorf("add watch > %w", syscall.ENOSPC)),
+			remedy: "sudo sysctl fs.inotify.max_user_watches=",
+		},
+		{
+			name:   "should tell how to raise the limit of inotify instances",
+			err:    instanceLimitError(syscall.EMFILE),
+			remedy: "sudo sysctl fs.inotify.max_user_instances=",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, errors.Is(tt.err, ErrWatchLimit), true)
+			assert.Equal(t, strings.Contains(tt.err.Error(), tt.remedy), true)
+		})
+	}
+}
+
+func TestInstanceLimitError_Other(t *testing.T) {
+	err := instanceLimitError(syscall.EACCES)
+
+	assert.Equal(t, errors.Is(err, ErrWatchLimit), false)
+	assert.Equal(t, errors.Is(err, syscall.EACCES), true)
+}
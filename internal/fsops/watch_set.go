@@ -0,0 +1,212 @@
+package fsops
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-imk/internal/logger"
+)
+
+// watchSet keeps track of the requested paths. Directories are watched directly, while files are
+// watched via their parent directories, so that editors saving files atomically (write to a
+// temporary file and rename it over the original) do not break the watch on the original inode.
+// Paths that do not exist yet are watched via their nearest existing ancestor until they appear.
+type watchSet struct {
+	dirs    map[string]bool // directories requested by the user
+	files   map[string]bool // files requested by the user
+	pending map[string]bool // requested paths that do not exist yet
+}
+
+func newWatchSet(paths []string) (*watchSet, error) {
+	set := &watchSet{
+		dirs:    make(map[string]bool),
+		files:   make(map[string]bool),
+		pending: make(map[string]bool),
+	}
+
+	for _, path := range paths {
+		path = filepath.Clean(path)
+
+		info, err := os.Stat(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			logger.Shoutf("%s does not exist - waiting for it to be created", path)
+			set.pending[path] = true
+		case err != nil:
+			return nil, fmt.Errorf("unable to watch file %s > %w", path, err)
+		case info.IsDir():
+			set.dirs[path] = true
+		default:
+			set.files[path] = true
+		}
+	}
+
+	return set, nil
+}
+
+// Dirs returns the directories to add to the underlying watcher.
+func (w *watchSet) Dirs() []string {
+	seen := make(map[string]bool)
+	dirs := make([]string, 0, len(w.dirs)+len(w.files)+len(w.pending))
+
+	add := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+
+	for dir := range w.dirs {
+		add(dir)
+	}
+
+	for file := range w.files {
+		add(filepath.Dir(file))
+	}
+
+	for path := range w.pending {
+		add(existingAncestor(path))
+	}
+
+	return dirs
+}
+
+// Paths returns the requested paths that are covered by the given watched directory.
+func (w *watchSet) Paths(dir string) []string {
+	paths := make([]string, 0)
+
+	if w.dirs[dir] {
+		paths = append(paths, dir)
+	}
+
+	for file := range w.files {
+		if filepath.Dir(file) == dir && !w.dirs[dir] {
+			paths = append(paths, file)
+		}
+	}
+
+	for path := range w.pending {
+		if existingAncestor(path) == dir {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+// Match reports whether the event for the path should be reported - either it happened in a
+// requested directory or it concerns one of the requested files. The watched root the path belongs
+// to is returned as well.
+func (w *watchSet) Match(path string) (string, bool) {
+	path = filepath.Clean(path)
+
+	switch {
+	case w.dirs[path]:
+		return path, true
+	case w.dirs[filepath.Dir(path)], w.files[path]:
+		return filepath.Dir(path), true
+	default:
+		return "", false
+	}
+}
+
+// Resolve updates the pending paths after the given path was created (or renamed into place) and
+// returns the directories that need to be watched now together with the pending paths that have
+// appeared.
+func (w *watchSet) Resolve(created string) ([]string, []string) {
+	created = filepath.Clean(created)
+	dirs := make([]string, 0)
+	appeared := make([]string, 0)
+
+	for path := range w.pending {
+		if path != created && !strings.HasPrefix(path, created+string(filepath.Separator)) {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			// one of the parents has appeared - move the watch closer to the path.
+			dirs = append(dirs, existingAncestor(path))
+			continue
+		}
+
+		delete(w.pending, path)
+		appeared = append(appeared, path)
+		logger.Shoutf("%s has been created - watching", path)
+
+		if info.IsDir() {
+			w.dirs[path] = true
+			dirs = append(dirs, path)
+		} else {
+			w.files[path] = true
+			dirs = append(dirs, filepath.Dir(path))
+		}
+	}
+
+	return dirs, appeared
+}
+
+// Removed moves the requested paths that are gone after the given path was removed (or renamed
+// away) back to pending and returns the directories to watch for them to appear again.
+func (w *watchSet) Removed(removed string) []string {
+	removed = filepath.Clean(removed)
+	dirs := make([]string, 0)
+
+	for _, paths := range []map[string]bool{w.dirs, w.files} {
+		for path := range paths {
+			if path != removed && !strings.HasPrefix(path, removed+string(filepath.Separator)) {
+				continue
+			}
+
+			// eg. a file replaced by an atomic save.
+			if _, err := os.Lstat(path); err == nil {
+				continue
+			}
+
+			// a removed file is still watched via its parent directory.
+			if !w.dirs[path] {
+				if info, err := os.Stat(filepath.Dir(path)); err == nil && info.IsDir() {
+					continue
+				}
+			}
+
+			delete(paths, path)
+			w.pending[path] = true
+			logger.Shoutf("%s has been removed - waiting for it to be created", path)
+
+			dirs = append(dirs, existingAncestor(path))
+		}
+	}
+
+	return dirs
+}
+
+// Rescan resolves the pending paths that have been created meanwhile and returns all the
+// directories that need to be watched.
+func (w *watchSet) Rescan() []string {
+	for path := range w.pending {
+		w.Resolve(path)
+	}
+
+	return w.Dirs()
+}
+
+// existingAncestor returns the nearest existing ancestor directory of the path.
+func existingAncestor(path string) string {
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return parent
+		}
+
+		if info, err := os.Stat(parent); err == nil && info.IsDir() {
+			return parent
+		}
+
+		path = parent
+	}
+}
@@ -1,14 +1,74 @@
 package fsops
 
-import "context"
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
 
 //go:generate moq -rm -fmt goimports -out watcher_mock.go . Watcher
 
-type Event struct {
-	Op   string
-	Path string
-}
-
 type Watcher interface {
+	// Watch starts watching the files. The events channel is closed when the context is cancelled
+	// or the watcher fails.
 	Watch(context.Context) (chan *Event, error)
+
+	// Err returns the error that stopped the watcher, if any.
+	Err() error
+}
+
+// Options configures the event filtering shared by all the watchers.
+type Options struct {
+	// Roots are the paths requested by the user. The RelPath of the events is computed relative to
+	// them rather than to the watched directories, which include the sub-directories of --recurse.
+	Roots []string
+	// ContentHash makes the watcher drop WRITE events that did not change the file content.
+	ContentHash bool
+}
+
+// watchBase holds the state shared by all the watchers.
+type watchBase struct {
+	files        []string
+	roots        []string
+	contentCache *contentCache
+}
+
+func (b *watchBase) setOptions(opts Options) {
+	b.roots = make([]string, 0, len(opts.Roots))
+	for _, root := range opts.Roots {
+		b.roots = append(b.roots, filepath.Clean(root))
+	}
+
+	b.contentCache = nil
+	if opts.ContentHash {
+		b.contentCache = newContentCache(DefaultContentCacheSize)
+	}
+}
+
+// newEvent creates an event for the path reported for the watched directory.
+func (b *watchBase) newEvent(op Op, path, watched string) *Event {
+	return NewEvent(op, path, b.root(path, watched))
+}
+
+// root returns the deepest requested root the path is at or below of, or the watched directory if
+// there is none.
+func (b *watchBase) root(path, watched string) string {
+	root := ""
+
+	for _, candidate := range b.roots {
+		rel, err := filepath.Rel(candidate, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		if len(candidate) > len(root) {
+			root = candidate
+		}
+	}
+
+	if root == "" {
+		return watched
+	}
+
+	return root
 }
@@ -18,6 +18,9 @@ var _ Watcher = &WatcherMock{}
 //
 //		// make and configure a mocked Watcher
 //		mockedWatcher := &WatcherMock{
+//			ErrFunc: func() error {
+//				panic("mock out the Err method")
+//			},
 //			WatchFunc: func(contextMoqParam context.Context) (chan *Event, error) {
 //				panic("mock out the Watch method")
 //			},
@@ -28,20 +31,54 @@ var _ Watcher = &WatcherMock{}
 //
 //	}
 type WatcherMock struct {
+	// ErrFunc mocks the Err method.
+	ErrFunc func() error
+
 	// WatchFunc mocks the Watch method.
 	WatchFunc func(contextMoqParam context.Context) (chan *Event, error)
 
 	// calls tracks calls to the methods.
 	calls struct {
+		// Err holds details about calls to the Err method.
+		Err []struct {
+		}
 		// Watch holds details about calls to the Watch method.
 		Watch []struct {
 			// ContextMoqParam is the contextMoqParam argument value.
 			ContextMoqParam context.Context
 		}
 	}
+	lockErr   sync.RWMutex
 	lockWatch sync.RWMutex
 }
 
+// Err calls ErrFunc.
+func (mock *WatcherMock) Err() error {
+	if mock.ErrFunc == nil {
+		panic("WatcherMock.ErrFunc: method is nil but Watcher.Err was just called")
+	}
+	callInfo := struct {
+	}{}
+	mock.lockErr.Lock()
+	mock.calls.Err = append(mock.calls.Err, callInfo)
+	mock.lockErr.Unlock()
+	return mock.ErrFunc()
+}
+
+// ErrCalls gets all the calls that were made to Err.
+// Check the length with:
+//
+//	len(mockedWatcher.ErrCalls())
+func (mock *WatcherMock) ErrCalls() []struct {
+} {
+	var calls []struct {
+	}
+	mock.lockErr.RLock()
+	calls = mock.calls.Err
+	mock.lockErr.RUnlock()
+	return calls
+}
+
 // Watch calls WatchFunc.
 func (mock *WatcherMock) Watch(contextMoqParam context.Context) (chan *Event, error) {
 	if mock.WatchFunc == nil {
@@ -0,0 +1,141 @@
+package git
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+)
+
+// ignoreRule is a single pattern of a .gitignore file.
+type ignoreRule struct {
+	pattern  string
+	base     string // directory of the .gitignore file relative to the work tree root.
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreMatcher implements the subset of the gitignore rules used in practice: negation,
+// directory-only patterns, anchored patterns and "**" wildcards.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+func newIgnoreMatcher() *ignoreMatcher {
+	return &ignoreMatcher{}
+}
+
+// load adds the rules from the ignore file. The base is the directory of the file relative to the
+// work tree root ("" for the root). Missing files are skipped.
+func (m *ignoreMatcher) load(file, base string) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text(), base); ok {
+			m.rules = append(m.rules, rule)
+		}
+	}
+}
+
+// Ignored reports whether the slash separated path relative to the work tree root is ignored.
+// The last matching rule wins.
+func (m *ignoreMatcher) Ignored(rel string, isDir bool) bool {
+	ignored := false
+
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		if rule.matches(rel) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+func parseIgnoreRule(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+
+	line = strings.TrimPrefix(line, "\\")
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// a slash at the beginning or in the middle anchors the pattern to the .gitignore directory.
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	rule.pattern = line
+
+	return rule, true
+}
+
+func (r ignoreRule) matches(rel string) bool {
+	if r.base != "" {
+		var ok bool
+		if rel, ok = strings.CutPrefix(rel, r.base+"/"); !ok {
+			return false
+		}
+	}
+
+	if !r.anchored {
+		return matchGlob(r.pattern, path.Base(rel))
+	}
+
+	return matchSegments(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches the path segments against the pattern segments, where "**" matches any
+// number of segments.
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(segments) == 0 || !matchGlob(pattern[0], segments[0]) {
+			return false
+		}
+
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+func matchGlob(pattern, name string) bool {
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
@@ -0,0 +1,111 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	indexSignature  = "DIRC"
+	indexHeaderLen  = 12
+	indexEntryLen   = 62 // fixed part of an entry up to and including the flags.
+	flagExtended    = 0x4000
+	flagNameMask    = 0x0fff
+	modeTypeMask    = 0o170000
+	modeTypeDir     = 0o040000 // sparse directory entries.
+	extendedFlagLen = 2
+)
+
+var errInvalidIndex = errors.New("invalid index file")
+
+// ReadIndex reads the paths (relative to the work tree, slash separated) of the entries of the
+// index file. Versions 2, 3 and 4 of the index format are supported.
+func ReadIndex(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := parseIndex(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s > %w", path, err)
+	}
+
+	return files, nil
+}
+
+func parseIndex(data []byte) ([]string, error) {
+	if len(data) < indexHeaderLen || string(data[:4]) != indexSignature {
+		return nil, errInvalidIndex
+	}
+
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("%w: unsupported version %d", errInvalidIndex, version)
+	}
+
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+	files := make([]string, 0, count)
+	offset := indexHeaderLen
+	prev := ""
+
+	for i := 0; i < count; i++ {
+		if offset+indexEntryLen > len(data) {
+			return nil, errInvalidIndex
+		}
+
+		entry := data[offset:]
+		mode := binary.BigEndian.Uint32(entry[24:28])
+		flags := binary.BigEndian.Uint16(entry[60:62])
+
+		start := indexEntryLen
+		if flags&flagExtended != 0 {
+			start += extendedFlagLen
+		}
+
+		var name string
+		var entryLen int
+
+		if version == 4 {
+			// the path is prefix compressed: number of bytes to remove from the previous path
+			// followed by the NUL terminated suffix.
+			strip, n := binary.Uvarint(entry[start:])
+			if n <= 0 || int(strip) > len(prev) {
+				return nil, errInvalidIndex
+			}
+
+			end := bytes.IndexByte(entry[start+n:], 0)
+			if end < 0 {
+				return nil, errInvalidIndex
+			}
+
+			name = prev[:len(prev)-int(strip)] + string(entry[start+n:start+n+end])
+			entryLen = start + n + end + 1
+		} else {
+			nameLen := int(flags & flagNameMask)
+			end := bytes.IndexByte(entry[start:], 0)
+
+			if end < 0 || (nameLen < flagNameMask && end != nameLen) {
+				return nil, errInvalidIndex
+			}
+
+			name = string(entry[start : start+end])
+			// entries are padded with 1-8 NUL bytes to a multiple of 8 bytes.
+			entryLen = (start + end + 8) &^ 7
+		}
+
+		// conflicting entries have the same path in several stages.
+		isDup := len(files) > 0 && files[len(files)-1] == name
+		if mode&modeTypeMask != modeTypeDir && !isDup {
+			files = append(files, name)
+		}
+
+		prev = name
+		offset += entryLen
+	}
+
+	return files, nil
+}
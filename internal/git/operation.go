@@ -0,0 +1,188 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// maxReflogEntry is the number of bytes read from the end of the reflog to find the last entry.
+const maxReflogEntry = 4096
+
+// Operation is a git operation that moved HEAD (eg. checkout, commit, rebase, merge or pull).
+type Operation struct {
+	// Name is the name of the operation, eg. "checkout".
+	Name string
+	// Message is the rest of the reflog message, eg. "moving from main to feature".
+	Message string
+
+	entry string
+}
+
+func (o Operation) String() string {
+	if o.Message == "" {
+		return o.Name
+	}
+
+	return o.Name + ": " + o.Message
+}
+
+// OperationPaths returns the files git creates or updates while running an operation that
+// changes HEAD or the work tree.
+func (r *Repo) OperationPaths() []string {
+	return []string{
+		r.HeadPath(),
+		filepath.Join(r.GitDir, "index.lock"),
+		filepath.Join(r.GitDir, "ORIG_HEAD"),
+	}
+}
+
+// Locked reports whether the index is locked, ie. a git command is updating it.
+func (r *Repo) Locked() bool {
+	_, err := os.Stat(filepath.Join(r.GitDir, "index.lock"))
+	return err == nil
+}
+
+// LastOperation returns the last operation recorded in the reflog of HEAD. The zero Operation
+// is returned if there is no reflog.
+func (r *Repo) LastOperation() (Operation, error) {
+	file, err := os.Open(filepath.Join(r.GitDir, "logs", "HEAD"))
+	if os.IsNotExist(err) {
+		return Operation{}, nil
+	} else if err != nil {
+		return Operation{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Operation{}, err
+	}
+
+	offset := max(info.Size()-maxReflogEntry, 0)
+
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+	if err != nil {
+		return Operation{}, err
+	}
+
+	data = bytes.TrimRight(data, "\n")
+	if idx := bytes.LastIndexByte(data, '\n'); idx >= 0 {
+		data = data[idx+1:]
+	}
+
+	return parseReflogEntry(string(data)), nil
+}
+
+// parseReflogEntry parses the "<old> <new> <committer> <time> <tz>\t<message>" reflog entry. The
+// operation name is the first word of the message before the colon, eg. "rebase (finish): ..."
+// or "merge feature: Fast-forward".
+func parseReflogEntry(entry string) Operation {
+	op := Operation{entry: entry}
+
+	_, msg, ok := strings.Cut(entry, "\t")
+	if !ok {
+		return op
+	}
+
+	name, rest, _ := strings.Cut(msg, ":")
+	op.Message = strings.TrimSpace(rest)
+
+	if fields := strings.Fields(name); len(fields) > 0 {
+		op.Name = fields[0]
+	}
+
+	return op
+}
+
+// OperationTracker recognises git operations from the changes of the files in the git directory.
+// Once an operation starts, the changes of the work tree are collected instead of triggering the
+// commands, until the operation settles. It is not safe for concurrent use.
+type OperationTracker struct {
+	repo  *Repo
+	paths map[string]bool
+
+	busy  bool
+	last  Operation
+	files []string
+}
+
+func NewOperationTracker(repo *Repo) (*OperationTracker, error) {
+	last, err := repo.LastOperation()
+	if err != nil {
+		return nil, err
+	}
+
+	tracker := &OperationTracker{
+		repo:  repo,
+		paths: make(map[string]bool),
+		last:  last,
+	}
+
+	for _, path := range repo.OperationPaths() {
+		tracker.paths[path] = true
+	}
+
+	return tracker, nil
+}
+
+// Track handles the change of the path. It reports whether the path belongs to the git directory,
+// in which case it should not trigger the commands. A change of any of the operation paths marks
+// the start of an operation.
+func (t *OperationTracker) Track(path string) bool {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	if path != t.repo.GitDir && !strings.HasPrefix(path, t.repo.GitDir+string(filepath.Separator)) {
+		return false
+	}
+
+	if t.paths[path] {
+		t.busy = true
+	}
+
+	return true
+}
+
+// Busy reports whether an operation is in progress.
+func (t *OperationTracker) Busy() bool {
+	return t.busy
+}
+
+// Suppress records the change of a work tree file made while an operation is in progress.
+func (t *OperationTracker) Suppress(path string) {
+	if !slices.Contains(t.files, path) {
+		t.files = append(t.files, path)
+	}
+}
+
+// Settle ends the operation unless the index is still locked, in which case done is false. It
+// returns the operation if HEAD was moved (nil otherwise, eg. after git add) and the changes of
+// the work tree suppressed meanwhile.
+func (t *OperationTracker) Settle() (op *Operation, files []string, done bool, err error) {
+	if t.repo.Locked() {
+		return nil, nil, false, nil
+	}
+
+	files = t.files
+	t.busy = false
+	t.files = nil
+
+	last, err := t.repo.LastOperation()
+	if err != nil {
+		return nil, files, true, err
+	}
+
+	if last != t.last {
+		op = &last
+	}
+
+	t.last = last
+
+	return op, files, true, nil
+}
@@ -0,0 +1,100 @@
+package git_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-imk/internal/git"
+	"go-imk/test/assert"
+)
+
+const reflogPrefix = "0000000000000000000000000000000000000000 1111111111111111111111111111111111111111 " +
+	"A U Thor <author@example.com> 1700000000 +0000\t"
+
+func appendReflog(t *testing.T, repo *git.Repo, msg string) {
+	t.Helper()
+
+	file, err := os.OpenFile(filepath.Join(repo.GitDir, "logs", "HEAD"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	_, err = file.WriteString(reflogPrefix + msg + "\n")
+	assert.NoError(t, err)
+}
+
+func TestRepo_LastOperation(t *testing.T) {
+	tests := []struct {
+		msg     string
+		name    string
+		message string
+	}{
+		{msg: "checkout: moving from main to feature", name: "checkout", message: "moving from main to feature"},
+		{msg: "rebase (finish): returning to refs/heads/feature", name: "rebase", message: "returning to refs/heads/feature"},
+		{msg: "merge feature: Fast-forward", name: "merge", message: "Fast-forward"},
+		{msg: "pull --rebase origin main (start): checkout abc", name: "pull", message: "checkout abc"},
+		{msg: "commit (amend): fix typo", name: "commit", message: "fix typo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &git.Repo{Root: t.TempDir()}
+			repo.GitDir = filepath.Join(repo.Root, ".git")
+			assert.NoError(t, os.MkdirAll(filepath.Join(repo.GitDir, "logs"), 0o700))
+
+			appendReflog(t, repo, "commit (initial): init")
+			appendReflog(t, repo, tt.msg)
+
+			op, err := repo.LastOperation()
+			assert.NoError(t, err)
+			assert.Equal(t, op.Name, tt.name)
+			assert.Equal(t, op.Message, tt.message)
+		})
+	}
+}
+
+func TestOperationTracker(t *testing.T) {
+	repo := &git.Repo{Root: t.TempDir()}
+	repo.GitDir = filepath.Join(repo.Root, ".git")
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo.GitDir, "logs"), 0o700))
+	appendReflog(t, repo, "commit (initial): init")
+
+	tracker, err := git.NewOperationTracker(repo)
+	assert.NoError(t, err)
+
+	lock := filepath.Join(repo.GitDir, "index.lock")
+
+	// files outside of the git directory are left alone, other git files do not start an operation.
+	assert.Equal(t, tracker.Track(filepath.Join(repo.Root, "main.go")), false)
+	assert.Equal(t, tracker.Track(filepath.Join(repo.GitDir, "FETCH_HEAD")), true)
+	assert.Equal(t, tracker.Busy(), false)
+
+	assert.NoError(t, os.WriteFile(lock, nil, 0o600))
+	assert.Equal(t, tracker.Track(lock), true)
+	assert.Equal(t, tracker.Busy(), true)
+
+	tracker.Suppress("main.go")
+	tracker.Suppress("main.go")
+
+	_, _, done, err := tracker.Settle()
+	assert.NoError(t, err)
+	assert.Equal(t, done, false)
+
+	assert.NoError(t, os.Remove(lock))
+	appendReflog(t, repo, "checkout: moving from main to feature")
+
+	op, files, done, err := tracker.Settle()
+	assert.NoError(t, err)
+	assert.Equal(t, done, true)
+	assert.Equal(t, op.String(), "checkout: moving from main to feature")
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, tracker.Busy(), false)
+
+	// git add only updates the index.
+	assert.Equal(t, tracker.Track(lock), true)
+
+	op, _, done, err = tracker.Settle()
+	assert.NoError(t, err)
+	assert.Equal(t, done, true)
+	assert.Equal(t, op == nil, true)
+}
@@ -0,0 +1,175 @@
+// Package git reads the state of a git repository (the list of files and the operations run on
+// it) directly from the .git directory without running git.
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNotRepository = errors.New("not a git repository")
+
+type Repo struct {
+	// Root is the absolute path of the work tree.
+	Root string
+	// GitDir is the absolute path of the git directory (.git or the work tree specific one).
+	GitDir string
+}
+
+// FindRepo finds the repository the directory belongs to by looking for .git in the directory
+// and its parents.
+func FindRepo(dir string) (*Repo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		gitPath := filepath.Join(dir, ".git")
+
+		info, err := os.Stat(gitPath)
+		switch {
+		case err == nil && info.IsDir():
+			return &Repo{Root: dir, GitDir: gitPath}, nil
+
+		case err == nil:
+			// work trees and submodules have a .git file pointing to the git directory.
+			gitDir, err := readGitFile(gitPath)
+			if err != nil {
+				return nil, err
+			}
+
+			return &Repo{Root: dir, GitDir: gitDir}, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ErrNotRepository
+		}
+
+		dir = parent
+	}
+}
+
+// IndexPath returns the path of the index file.
+func (r *Repo) IndexPath() string {
+	return filepath.Join(r.GitDir, "index")
+}
+
+// HeadPath returns the path of the HEAD file.
+func (r *Repo) HeadPath() string {
+	return filepath.Join(r.GitDir, "HEAD")
+}
+
+// Files returns the tracked files and the untracked files that are not ignored. Only the files
+// below the given directory are returned, relative to it (same as git ls-files).
+func (r *Repo) Files(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	tracked, err := ReadIndex(r.IndexPath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	untracked, err := r.untracked(tracked)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(tracked)+len(untracked))
+
+	for _, file := range append(tracked, untracked...) {
+		rel, err := filepath.Rel(dir, filepath.Join(r.Root, filepath.FromSlash(file)))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+
+		files = append(files, rel)
+	}
+
+	return files, nil
+}
+
+// untracked walks the work tree and returns the files (relative to the root, slash separated)
+// that are neither tracked nor ignored.
+func (r *Repo) untracked(tracked []string) ([]string, error) {
+	known := make(map[string]bool, len(tracked))
+	for _, file := range tracked {
+		known[file] = true
+	}
+
+	ignore := newIgnoreMatcher()
+	ignore.load(filepath.Join(r.GitDir, "info", "exclude"), "")
+
+	files := make([]string, 0)
+
+	err := filepath.WalkDir(r.Root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil // skip unreadable paths like git does.
+		}
+
+		rel, err := filepath.Rel(r.Root, path)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if entry.IsDir() {
+			if rel == "." {
+				ignore.load(filepath.Join(path, ".gitignore"), "")
+				return nil
+			}
+
+			if entry.Name() == ".git" || ignore.Ignored(rel, true) || isNestedRepo(path) {
+				return filepath.SkipDir
+			}
+
+			ignore.load(filepath.Join(path, ".gitignore"), rel)
+
+			return nil
+		}
+
+		if !known[rel] && !ignore.Ignored(rel, false) {
+			files = append(files, rel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list untracked files > %w", err)
+	}
+
+	return files, nil
+}
+
+func isNestedRepo(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// readGitFile reads the "gitdir: <path>" pointer from a .git file.
+func readGitFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %s > %w", path, err)
+	}
+
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("invalid git file %s", path)
+	}
+
+	gitDir = strings.TrimSpace(gitDir)
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+
+	return filepath.Clean(gitDir), nil
+}
@@ -0,0 +1,92 @@
+package git_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-imk/internal/git"
+	"go-imk/test/assert"
+)
+
+// writeIndex writes a version 2 index file with the given (sorted) paths.
+func writeIndex(t *testing.T, path string, files []string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	buf.WriteString("DIRC")
+	_ = binary.Write(&buf, binary.BigEndian, uint32(2))
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(files)))
+
+	for _, file := range files {
+		entry := make([]byte, 62)
+		binary.BigEndian.PutUint32(entry[24:28], 0o100644)
+		binary.BigEndian.PutUint16(entry[60:62], uint16(len(file)))
+
+		entry = append(entry, file...)
+		entry = append(entry, make([]byte, 8-len(entry)%8)...)
+		buf.Write(entry)
+	}
+
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+}
+
+func TestRepo_Files(t *testing.T) {
+	root := t.TempDir()
+
+	for _, dir := range []string{".git/info", "src/build", "docs"} {
+		assert.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0o700))
+	}
+
+	for _, file := range []string{
+		"main.go", "src/app.go", "src/new.go", "src/debug.log", "src/build/out.bin", "docs/notes.md",
+	} {
+		assert.NoError(t, os.WriteFile(filepath.Join(root, file), nil, 0o600))
+	}
+
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.log\nbuild/\n"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, ".git", "info", "exclude"), []byte("/docs\n"), 0o600))
+	writeIndex(t, filepath.Join(root, ".git", "index"), []string{".gitignore", "main.go", "src/app.go"})
+
+	repo, err := git.FindRepo(filepath.Join(root, "src"))
+	assert.NoError(t, err)
+	assert.Equal(t, repo.Root, root)
+
+	tests := []struct {
+		name string
+		dir  string
+		want []string
+	}{
+		{
+			name: "should list tracked and untracked files that are not ignored",
+			dir:  root,
+			want: []string{".gitignore", "main.go", "src/app.go", "src/new.go"},
+		},
+		{
+			name: "should list the files under the directory only",
+			dir:  filepath.Join(root, "src"),
+			want: []string{"app.go", "new.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := repo.Files(tt.dir)
+			assert.NoError(t, err)
+
+			for i, file := range files {
+				files[i] = filepath.ToSlash(file)
+			}
+
+			assert.Equal(t, strings.Join(files, ","), strings.Join(tt.want, ","))
+		})
+	}
+}
+
+func TestFindRepo_NotRepository(t *testing.T) {
+	_, err := git.FindRepo(t.TempDir())
+	assert.Error(t, err)
+}
@@ -0,0 +1,216 @@
+// Package limits restricts the resources available to the commands - with a cgroup v2 if a
+// writable delegation is available and with setrlimit otherwise. The setrlimit limits are set by
+// imk itself, started in place of the command (see Run.Wrap and ExecWrapped).
+package limits
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Limits of a single run of a command. A zero value means no limit.
+type Limits struct {
+	Memory int64   // bytes.
+	CPU    float64 // number of CPUs (eg. 1.5).
+	Procs  int
+	Files  int
+}
+
+// IsZero reports whether no limit is set.
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+func (l Limits) String() string {
+	tokens := make([]string, 0, 4)
+
+	if l.Memory > 0 {
+		tokens = append(tokens, "memory "+FormatSize(l.Memory))
+	}
+
+	if l.CPU > 0 {
+		tokens = append(tokens, fmt.Sprintf("cpu %g", l.CPU))
+	}
+
+	if l.Procs > 0 {
+		tokens = append(tokens, fmt.Sprintf("procs %d", l.Procs))
+	}
+
+	if l.Files > 0 {
+		tokens = append(tokens, fmt.Sprintf("files %d", l.Files))
+	}
+
+	return strings.Join(tokens, " ")
+}
+
+// controllers returns the cgroup controllers needed to enforce the limits. The open files can
+// only be limited with setrlimit.
+func (l Limits) controllers() []string {
+	var controllers []string
+
+	if l.Memory > 0 {
+		controllers = append(controllers, "memory")
+	}
+
+	if l.CPU > 0 {
+		controllers = append(controllers, "cpu")
+	}
+
+	if l.Procs > 0 {
+		controllers = append(controllers, "pids")
+	}
+
+	return controllers
+}
+
+// Hits counts how many times the limits were reached during a run. They are counted if the run
+// had its own cgroup - without one, only a failed run that got close to the memory limit is
+// reported.
+type Hits struct {
+	Limits Limits
+
+	OOMKills   uint64 // processes killed because of the memory limit.
+	ForkFails  uint64 // forks refused because of the process limit.
+	Throttled  uint64 // periods in which the CPU quota was used up.
+	PeakMemory int64  // peak memory of a failed run close to the memory limit (without a cgroup).
+}
+
+// Any reports whether any limit was reached.
+func (h Hits) Any() bool {
+	return h.OOMKills > 0 || h.ForkFails > 0 || h.Throttled > 0 || h.PeakMemory > 0
+}
+
+func (h Hits) String() string {
+	tokens := make([]string, 0, 3)
+
+	if h.OOMKills > 0 {
+		tokens = append(tokens, fmt.Sprintf("memory %s (%d processes killed)",
+			FormatSize(h.Limits.Memory), h.OOMKills))
+	}
+
+	if h.PeakMemory > 0 {
+		tokens = append(tokens, fmt.Sprintf("memory %s (failed at a peak of %s)",
+			FormatSize(h.Limits.Memory), FormatSize(h.PeakMemory)))
+	}
+
+	if h.ForkFails > 0 {
+		tokens = append(tokens, fmt.Sprintf("procs %d (%d forks refused)", h.Limits.Procs, h.ForkFails))
+	}
+
+	if h.Throttled > 0 {
+		tokens = append(tokens, fmt.Sprintf("cpu %g (throttled %d times)", h.Limits.CPU, h.Throttled))
+	}
+
+	return strings.Join(tokens, ", ")
+}
+
+// Manager applies the limits to the runs of the commands. It is safe for concurrent use.
+type Manager struct {
+	limits Limits
+
+	// base is the cgroup the cgroups of the runs are created in (empty - setrlimit only).
+	base string
+	runs atomic.Int64
+
+	// leaf is the child cgroup imk moved itself into to enable the controllers of base and
+	// enabled are the controllers it enabled then.
+	leaf    string
+	enabled []string
+}
+
+func NewManager(limits Limits) *Manager {
+	return &Manager{limits: limits}
+}
+
+// Run holds the limits applied to a single run of a command.
+type Run struct {
+	limits Limits
+
+	// cgroup of the run (empty if the limits are applied with setrlimit only).
+	cgroup string
+	dir    *os.File
+
+	// peakMemory is the peak memory of a failed run close to the memory limit (see Exited).
+	peakMemory int64
+}
+
+// FormatSize formats a size in bytes with a K, M or G suffix if it is a whole multiple.
+func FormatSize(size int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}} {
+		if size%unit.size == 0 {
+			return strconv.FormatInt(size/unit.size, 10) + unit.suffix
+		}
+	}
+
+	return strconv.FormatInt(size, 10)
+}
+
+// formatRlimits formats the setrlimit limits passed to imk running as a wrapper (see
+// parseRlimits).
+func formatRlimits(rlimits map[int]uint64) string {
+	tokens := make([]string, 0, len(rlimits))
+	for resource, limit := range rlimits {
+		tokens = append(tokens, fmt.Sprintf("%d=%d", resource, limit))
+	}
+
+	slices.Sort(tokens)
+
+	return strings.Join(tokens, ",")
+}
+
+// parseRlimits parses the setrlimit limits formatted by formatRlimits.
+func parseRlimits(spec string) (map[int]uint64, error) {
+	rlimits := make(map[int]uint64)
+
+	for token := range strings.SplitSeq(spec, ",") {
+		resource, limit, ok := strings.Cut(token, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid resource limit %q", token)
+		}
+
+		r, err := strconv.Atoi(resource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource limit %q > %w", token, err)
+		}
+
+		l, err := strconv.ParseUint(limit, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource limit %q > %w", token, err)
+		}
+
+		rlimits[r] = l
+	}
+
+	return rlimits, nil
+}
+
+// readCounters reads a flat-keyed cgroup file (eg. memory.events - "oom_kill 1" per line).
+func readCounters(r io.Reader) (map[string]uint64, error) {
+	counters := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !ok {
+			continue
+		}
+
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid counter %q > %w", scanner.Text(), err)
+		}
+
+		counters[key] = n
+	}
+
+	return counters, scanner.Err()
+}
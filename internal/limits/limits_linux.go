@@ -0,0 +1,473 @@
+//go:build linux
+
+package limits
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// cpuPeriod is the cgroup CPU accounting period in microseconds (the kernel default).
+	cpuPeriod = 100000
+
+	// peakMemoryRatio is how close (in percent) to the memory limit a failed run must have got to
+	// report the limit as reached.
+	peakMemoryRatio = 90
+
+	// rlimitsEnv and execPathEnv pass the limits and the program to imk running as a wrapper.
+	rlimitsEnv  = "IMK_RLIMITS"
+	execPathEnv = "IMK_EXEC_PATH"
+
+	// wrapFailed is the exit code of the wrapper if it cannot execute the program (as with sh).
+	wrapFailed = 126
+)
+
+// EnableCgroups prepares the cgroup v2 delegation the runs get their own cgroups in. It fails if
+// there is no writable delegation with the controllers the limits need - the limits are then
+// applied with setrlimit only.
+//
+// A cgroup with processes cannot pass the controllers to its children, so if imk is the only
+// process in its cgroup (eg. started with systemd-run --user --scope -p Delegate=yes), imk moves
+// itself into a child cgroup first.
+func (m *Manager) EnableCgroups() error {
+	controllers := m.limits.controllers()
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	base, err := selfCgroup()
+	if err != nil {
+		return err
+	}
+
+	enabled, err := enableControllers(base, controllers)
+	if errors.Is(err, unix.EBUSY) {
+		if m.leaf, err = leaveCgroup(base); err != nil {
+			return err
+		}
+
+		if enabled, err = enableControllers(base, controllers); err != nil {
+			_ = m.restoreCgroup(base, nil)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.base = base
+	m.enabled = enabled
+
+	return nil
+}
+
+// Close undoes EnableCgroups once all the runs are closed - if imk moved itself into a child
+// cgroup, it disables the controllers it enabled, moves itself back and removes the child.
+func (m *Manager) Close() error {
+	if m.leaf == "" {
+		return nil
+	}
+
+	return m.restoreCgroup(m.base, m.enabled)
+}
+
+// restoreCgroup disables the controllers of the base cgroup, moves imk back into it and removes
+// the child cgroup imk moved to.
+func (m *Manager) restoreCgroup(base string, enabled []string) error {
+	if len(enabled) > 0 {
+		disabled := make([]string, 0, len(enabled))
+		for _, controller := range enabled {
+			disabled = append(disabled, "-"+controller)
+		}
+
+		err := os.WriteFile(filepath.Join(base, "cgroup.subtree_control"), []byte(strings.Join(disabled, " ")), 0)
+		if err != nil {
+			return fmt.Errorf("unable to disable cgroup controllers > %w", err)
+		}
+	}
+
+	self := strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(filepath.Join(base, "cgroup.procs"), []byte(self), 0); err != nil {
+		return fmt.Errorf("unable to move imk to cgroup %s > %w", base, err)
+	}
+
+	if err := os.Remove(m.leaf); err != nil {
+		return fmt.Errorf("unable to remove cgroup > %w", err)
+	}
+
+	m.leaf = ""
+	m.base = ""
+	m.enabled = nil
+
+	return nil
+}
+
+// Start prepares the limits of a new run - a new cgroup if the cgroups are enabled.
+func (m *Manager) Start() (*Run, error) {
+	run := &Run{limits: m.limits}
+	if m.base == "" {
+		return run, nil
+	}
+
+	path := filepath.Join(m.base, fmt.Sprintf("imk-%d-run%d", os.Getpid(), m.runs.Add(1)))
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return nil, fmt.Errorf("unable to create cgroup > %w", err)
+	}
+
+	run.cgroup = path
+
+	if err := run.writeLimits(); err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	dir, err := os.Open(path)
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("unable to open cgroup > %w", err)
+	}
+
+	run.dir = dir
+
+	return run, nil
+}
+
+// ProcAttr makes the process start directly in the cgroup of the run, so that none of its
+// children can escape the limits.
+func (r *Run) ProcAttr(attr *syscall.SysProcAttr) {
+	if r.dir == nil {
+		return
+	}
+
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(r.dir.Fd())
+}
+
+// Wrap makes the command apply the limits that are not enforced by the cgroup to itself before
+// the program starts - the command starts imk instead, which sets the limits and executes the
+// program (see ExecWrapped). Applying them to the started process would race with the program.
+// It must be called once the environment of the command is set.
+//
+// Without a cgroup the memory limit caps the data segment and the process limit counts all the
+// processes of the user (see setrlimit(2)). The CPU quota needs a cgroup.
+func (r *Run) Wrap(cmd *exec.Cmd) error {
+	rlimits := r.rlimits()
+	if len(rlimits) == 0 || cmd.Err != nil {
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to find the imk executable > %w", err)
+	}
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+
+	cmd.Env = append(cmd.Env, rlimitsEnv+"="+formatRlimits(rlimits), execPathEnv+"="+cmd.Path)
+	cmd.Path = self
+
+	return nil
+}
+
+// Exited records the limits the run has likely reached, judging by how its process exited. It
+// is only needed without a cgroup, which counts the hits itself.
+func (r *Run) Exited(state *os.ProcessState) {
+	if r.cgroup != "" || state == nil || state.Success() || r.limits.Memory <= 0 {
+		return
+	}
+
+	usage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return
+	}
+
+	// a failed allocation rarely leaves a trace other than a failed run - consider the limit
+	// reached if the run got close to it.
+	peak := int64(usage.Maxrss) << 10 // KiB.
+	if peak >= r.limits.Memory*peakMemoryRatio/100 {
+		r.peakMemory = peak
+	}
+}
+
+// rlimits returns the limits applied with setrlimit.
+func (r *Run) rlimits() map[int]uint64 {
+	rlimits := make(map[int]uint64)
+
+	if r.limits.Files > 0 {
+		rlimits[unix.RLIMIT_NOFILE] = uint64(r.limits.Files)
+	}
+
+	if r.cgroup == "" && r.limits.Memory > 0 {
+		rlimits[unix.RLIMIT_DATA] = uint64(r.limits.Memory)
+	}
+
+	if r.cgroup == "" && r.limits.Procs > 0 {
+		rlimits[unix.RLIMIT_NPROC] = uint64(r.limits.Procs)
+	}
+
+	return rlimits
+}
+
+// ExecWrapped executes the program of a command wrapped by Run.Wrap with the limits applied. It
+// must be called first thing in main and returns only if imk is not running as a wrapper.
+func ExecWrapped() {
+	spec, ok := os.LookupEnv(rlimitsEnv)
+	if !ok {
+		return
+	}
+
+	path := os.Getenv(execPathEnv)
+
+	_ = os.Unsetenv(rlimitsEnv)
+	_ = os.Unsetenv(execPathEnv)
+
+	rlimits, err := parseRlimits(spec)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "imk: %s\n", err)
+		os.Exit(wrapFailed)
+	}
+
+	for resource, limit := range rlimits {
+		// the syscall package (unlike x/sys/unix) keeps the open files limit across the exec.
+		rlimit := syscall.Rlimit{Cur: limit, Max: limit}
+		if err := syscall.Setrlimit(resource, &rlimit); err != nil {
+			fmt.Fprintf(os.Stderr, "imk: unable to set resource limits > %s\n", err)
+			os.Exit(wrapFailed)
+		}
+	}
+
+	//nolint:gosec // G204 - need to run the command.
+	err = syscall.Exec(path, os.Args, os.Environ())
+	fmt.Fprintf(os.Stderr, "imk: unable to execute %s > %s\n", path, err)
+	os.Exit(wrapFailed)
+}
+
+// Hits reports the limits reached during the run.
+func (r *Run) Hits() Hits {
+	hits := Hits{Limits: r.limits, PeakMemory: r.peakMemory}
+	if r.cgroup == "" {
+		return hits
+	}
+
+	if counters, err := r.counters("memory.events"); err == nil {
+		hits.OOMKills = counters["oom_kill"]
+	}
+
+	if counters, err := r.counters("pids.events"); err == nil {
+		hits.ForkFails = counters["max"]
+	}
+
+	if counters, err := r.counters("cpu.stat"); err == nil {
+		hits.Throttled = counters["nr_throttled"]
+	}
+
+	return hits
+}
+
+// Pids returns the processes in the cgroup of the run.
+func (r *Run) Pids() []int {
+	if r.cgroup == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.cgroup, "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+
+	var pids []int
+
+	for _, field := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
+
+// Close removes the cgroup of the run. It fails if any process of the run is still alive.
+func (r *Run) Close() error {
+	if r.cgroup == "" {
+		return nil
+	}
+
+	r.dir.Close()
+
+	if err := os.Remove(r.cgroup); err != nil {
+		return fmt.Errorf("unable to remove cgroup > %w", err)
+	}
+
+	return nil
+}
+
+func (r *Run) writeLimits() error {
+	files := make(map[string]string)
+
+	if r.limits.Memory > 0 {
+		files["memory.max"] = strconv.FormatInt(r.limits.Memory, 10)
+	}
+
+	if r.limits.CPU > 0 {
+		files["cpu.max"] = fmt.Sprintf("%d %d", int64(r.limits.CPU*cpuPeriod), cpuPeriod)
+	}
+
+	if r.limits.Procs > 0 {
+		files["pids.max"] = strconv.Itoa(r.limits.Procs)
+	}
+
+	for name, value := range files {
+		if err := os.WriteFile(filepath.Join(r.cgroup, name), []byte(value), 0); err != nil {
+			return fmt.Errorf("unable to set cgroup limit %s > %w", name, err)
+		}
+	}
+
+	// do not let the run swap instead of hitting the memory limit (there may be no swap).
+	if r.limits.Memory > 0 {
+		_ = os.WriteFile(filepath.Join(r.cgroup, "memory.swap.max"), []byte("0"), 0)
+	}
+
+	return nil
+}
+
+func (r *Run) counters(name string) (map[string]uint64, error) {
+	f, err := os.Open(filepath.Join(r.cgroup, name))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readCounters(f)
+}
+
+// selfCgroup returns the path of the cgroup v2 imk runs in.
+func selfCgroup() (string, error) {
+	mount, err := cgroupMount()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", fmt.Errorf("unable to read cgroup > %w", err)
+	}
+
+	for line := range strings.SplitSeq(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			return filepath.Join(mount, path), nil
+		}
+	}
+
+	return "", errors.New("not in a cgroup v2")
+}
+
+// cgroupMount returns the mount point of the cgroup v2 hierarchy.
+func cgroupMount() (string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", fmt.Errorf("unable to read mounts > %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// the optional fields end with "-", followed by the file system type (see proc(5)).
+		fields := strings.Fields(scanner.Text())
+
+		sep := slices.Index(fields, "-")
+		if sep > 4 && sep+1 < len(fields) && fields[sep+1] == "cgroup2" {
+			return fields[4], nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("unable to read mounts > %w", err)
+	}
+
+	return "", errors.New("cgroup v2 is not mounted")
+}
+
+// enableControllers makes the controllers available to the children of the cgroup. It returns
+// the controllers that were not enabled before.
+func enableControllers(cgroup string, controllers []string) ([]string, error) {
+	available, err := os.ReadFile(filepath.Join(cgroup, "cgroup.controllers"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cgroup controllers > %w", err)
+	}
+
+	enabled, err := os.ReadFile(filepath.Join(cgroup, "cgroup.subtree_control"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read cgroup controllers > %w", err)
+	}
+
+	var missing []string
+
+	for _, controller := range controllers {
+		if !slices.Contains(strings.Fields(string(available)), controller) {
+			return nil, fmt.Errorf("controller %s is not delegated to %s", controller, cgroup)
+		}
+
+		if !slices.Contains(strings.Fields(string(enabled)), controller) {
+			missing = append(missing, controller)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	var added []string
+	for _, controller := range missing {
+		added = append(added, "+"+controller)
+	}
+
+	err = os.WriteFile(filepath.Join(cgroup, "cgroup.subtree_control"), []byte(strings.Join(added, " ")), 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to enable cgroup controllers > %w", err)
+	}
+
+	return missing, nil
+}
+
+// leaveCgroup moves imk into a child of its cgroup, so that the cgroup has no processes, and
+// returns the child. It refuses to do so if other processes share the cgroup - they are not imk's
+// to move.
+func leaveCgroup(cgroup string) (string, error) {
+	procs, err := os.ReadFile(filepath.Join(cgroup, "cgroup.procs"))
+	if err != nil {
+		return "", fmt.Errorf("unable to read cgroup processes > %w", err)
+	}
+
+	self := strconv.Itoa(os.Getpid())
+	for _, pid := range strings.Fields(string(procs)) {
+		if pid != self {
+			return "", fmt.Errorf("cgroup %s is shared with other processes "+
+				"(run imk in its own cgroup, eg. systemd-run --user --scope -p Delegate=yes)", cgroup)
+		}
+	}
+
+	leaf := filepath.Join(cgroup, "imk-"+self)
+	if err := os.Mkdir(leaf, 0o755); err != nil && !errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("unable to create cgroup > %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(self), 0); err != nil {
+		_ = os.Remove(leaf)
+		return "", fmt.Errorf("unable to move imk to cgroup %s > %w", leaf, err)
+	}
+
+	return leaf, nil
+}
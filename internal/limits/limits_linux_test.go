@@ -0,0 +1,35 @@
+package limits
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"go-imk/test/assert"
+)
+
+func TestMain(m *testing.M) {
+	// the wrapped commands start the test binary in place of imk.
+	ExecWrapped()
+
+	os.Exit(m.Run())
+}
+
+func TestRun_Wrap(t *testing.T) {
+	run := &Run{limits: Limits{Memory: 256 << 20, Files: 64, CPU: 1}}
+
+	cmd := exec.Command("sh", "-c", `ulimit -n; ulimit -d; echo "$IMK_RLIMITS"`)
+	assert.NoError(t, run.Wrap(cmd))
+
+	out, err := cmd.Output()
+	assert.NoError(t, err)
+	assert.Equal(t, string(out), "64\n262144\n\n")
+}
+
+func TestRun_WrapCgroup(t *testing.T) {
+	run := &Run{limits: Limits{Memory: 256 << 20, Procs: 10}, cgroup: "/sys/fs/cgroup/imk"}
+
+	cmd := exec.Command("true")
+	assert.NoError(t, run.Wrap(cmd))
+	assert.Equal(t, cmd.Env == nil, true)
+}
@@ -0,0 +1,50 @@
+//go:build !linux
+
+package limits
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+var errLimitsUnsupported = errors.New("resource limits are only supported on Linux")
+
+func (m *Manager) EnableCgroups() error {
+	return errLimitsUnsupported
+}
+
+func (m *Manager) Close() error {
+	return nil
+}
+
+func (m *Manager) Start() (*Run, error) {
+	return &Run{limits: m.limits}, nil
+}
+
+func (r *Run) ProcAttr(*syscall.SysProcAttr) {}
+
+func (r *Run) Wrap(*exec.Cmd) error {
+	if r.limits.IsZero() {
+		return nil
+	}
+
+	return errLimitsUnsupported
+}
+
+func (r *Run) Exited(*os.ProcessState) {}
+
+func ExecWrapped() {}
+
+func (r *Run) Hits() Hits {
+	return Hits{Limits: r.limits}
+}
+
+func (r *Run) Pids() []int {
+	return nil
+}
+
+func (r *Run) Close() error {
+	return nil
+}
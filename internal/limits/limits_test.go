@@ -0,0 +1,84 @@
+package limits
+
+import (
+	"strings"
+	"testing"
+
+	"go-imk/test/assert"
+)
+
+func TestLimits_String(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		want   string
+	}{
+		{
+			name:   "should be empty without limits",
+			limits: Limits{},
+			want:   "",
+		},
+		{
+			name:   "should list all the limits",
+			limits: Limits{Memory: 2 << 30, CPU: 1.5, Procs: 100, Files: 1024},
+			want:   "memory 2G cpu 1.5 procs 100 files 1024",
+		},
+		{
+			name:   "should use the largest whole unit",
+			limits: Limits{Memory: 1536 << 20},
+			want:   "memory 1536M",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.limits.String(), tt.want)
+			assert.Equal(t, tt.limits.IsZero(), tt.want == "")
+		})
+	}
+}
+
+func TestHits_String(t *testing.T) {
+	hits := Hits{
+		Limits:    Limits{Memory: 512 << 20, CPU: 2, Procs: 50},
+		OOMKills:  1,
+		ForkFails: 3,
+	}
+
+	assert.Equal(t, hits.Any(), true)
+	assert.Equal(t, hits.String(), "memory 512M (1 processes killed), procs 50 (3 forks refused)")
+	assert.Equal(t, Hits{}.Any(), false)
+}
+
+func TestReadCounters(t *testing.T) {
+	counters, err := readCounters(strings.NewReader("low 0\nhigh 0\nmax 12\noom 1\noom_kill 1\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, counters["oom_kill"], uint64(1))
+	assert.Equal(t, counters["max"], uint64(12))
+
+	_, err = readCounters(strings.NewReader("max x\n"))
+	assert.Error(t, err)
+}
+
+func TestHits_StringPeakMemory(t *testing.T) {
+	hits := Hits{Limits: Limits{Memory: 512 << 20}, PeakMemory: 500 << 20}
+
+	assert.Equal(t, hits.Any(), true)
+	assert.Equal(t, hits.String(), "memory 512M (failed at a peak of 500M)")
+}
+
+func TestParseRlimits(t *testing.T) {
+	spec := formatRlimits(map[int]uint64{7: 1024, 2: 1 << 30})
+	assert.Equal(t, spec, "2=1073741824,7=1024")
+
+	rlimits, err := parseRlimits(spec)
+	assert.NoError(t, err)
+	assert.Equal(t, len(rlimits), 2)
+	assert.Equal(t, rlimits[7], uint64(1024))
+	assert.Equal(t, rlimits[2], uint64(1<<30))
+
+	for _, spec := range []string{"", "7", "x=1", "7=-1"} {
+		_, err := parseRlimits(spec)
+		assert.Error(t, err)
+	}
+}
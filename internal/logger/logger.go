@@ -2,6 +2,8 @@ package logger
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"time"
 )
 
@@ -23,3 +25,14 @@ func Shoutf(format string, v ...interface{}) {
 	fmt.Printf(":: %s === %s ===\n",
 		time.Now().Format("15:04:05"), fmt.Sprintf(format, v...))
 }
+
+// ClearScreen clears the terminal and its scrollback. If stdout is not a terminal, a separator
+// line is printed instead.
+func ClearScreen() {
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Print("\033[H\033[2J\033[3J")
+		return
+	}
+
+	fmt.Println(strings.Repeat("=", 80))
+}
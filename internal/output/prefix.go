@@ -0,0 +1,147 @@
+// Package output provides writers used to decorate and redirect the output of child commands.
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const colorReset = "\033[0m"
+
+// MaxLineSize limits the partial line buffered by PrefixWriter. A longer line (eg. a progress bar
+// redrawn without newlines) is written out in pieces of this size.
+const MaxLineSize = 64 << 10
+
+var colors = map[string]string{
+	"none":    "",
+	"black":   "\033[30m",
+	"red":     "\033[31m",
+	"green":   "\033[32m",
+	"yellow":  "\033[33m",
+	"blue":    "\033[34m",
+	"magenta": "\033[35m",
+	"cyan":    "\033[36m",
+	"white":   "\033[37m",
+}
+
+// ValidateColor returns an error if the colour name is not supported.
+func ValidateColor(name string) error {
+	if _, ok := colors[name]; !ok {
+		return fmt.Errorf("unsupported color %q", name)
+	}
+
+	return nil
+}
+
+// PrefixWriter prepends a prefix (eg. "[build]") to every line written to the underlying writer.
+// Partial lines are buffered until a newline is received, Flush is called or MaxLineSize is
+// reached, so the lines of several commands writing to the same terminal do not get mixed up.
+type PrefixWriter struct {
+	out        io.Writer
+	prefix     string
+	color      string
+	timestamps bool
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func NewPrefixWriter(out io.Writer, name string) *PrefixWriter {
+	return &PrefixWriter{
+		out:    out,
+		prefix: "[" + name + "]",
+	}
+}
+
+func (p *PrefixWriter) WithColor(name string) *PrefixWriter {
+	p.color = colors[name]
+	return p
+}
+
+func (p *PrefixWriter) WithTimestamps(timestamps bool) *PrefixWriter {
+	p.timestamps = timestamps
+	return p
+}
+
+func (p *PrefixWriter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	written := 0
+
+	for len(data) > 0 {
+		end := len(data)
+		if idx := bytes.IndexByte(data, '\n'); idx >= 0 {
+			end = idx + 1
+		}
+
+		if room := MaxLineSize - len(p.buf); end > room {
+			end = room
+		}
+
+		p.buf = append(p.buf, data[:end]...)
+		data = data[end:]
+
+		if p.buf[len(p.buf)-1] == '\n' || len(p.buf) >= MaxLineSize {
+			line := p.buf
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+
+			err := p.writeLine(line)
+			p.buf = p.buf[:0]
+
+			if err != nil {
+				return written, err
+			}
+		}
+
+		written += end
+	}
+
+	return written, nil
+}
+
+// Flush writes out the buffered partial line, if any.
+func (p *PrefixWriter) Flush() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.buf) == 0 {
+		return nil
+	}
+
+	err := p.writeLine(append(p.buf, '\n'))
+	p.buf = nil
+
+	return err
+}
+
+func (p *PrefixWriter) writeLine(line []byte) error {
+	var header bytes.Buffer
+
+	if p.color != "" {
+		header.WriteString(p.color)
+	}
+
+	header.WriteString(p.prefix)
+
+	if p.timestamps {
+		header.WriteString(" ")
+		header.WriteString(time.Now().Format("15:04:05"))
+	}
+
+	if p.color != "" {
+		header.WriteString(colorReset)
+	}
+
+	header.WriteString(" ")
+	header.Write(line)
+
+	_, err := p.out.Write(header.Bytes())
+
+	return err
+}
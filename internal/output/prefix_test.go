@@ -0,0 +1,88 @@
+package output_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"go-imk/internal/output"
+	"go-imk/test/assert"
+)
+
+func TestPrefixWriter_Write(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		flush  bool
+		want   string
+	}{
+		{
+			name:   "should prefix every line",
+			writes: []string{"one\ntwo\n"},
+			want:   "[build] one\n[build] two\n",
+		},
+		{
+			name:   "should buffer partial lines",
+			writes: []string{"on", "e\ntw", "o\n"},
+			want:   "[build] one\n[build] two\n",
+		},
+		{
+			name:   "should keep partial line until flush",
+			writes: []string{"one\ntwo"},
+			want:   "[build] one\n",
+		},
+		{
+			name:   "should write partial line on flush",
+			writes: []string{"one\ntwo"},
+			flush:  true,
+			want:   "[build] one\n[build] two\n",
+		},
+		{
+			name:   "should write out a partial line that fills the buffer",
+			writes: []string{strings.Repeat("x", output.MaxLineSize+2)},
+			want:   "[build] " + strings.Repeat("x", output.MaxLineSize) + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := output.NewPrefixWriter(&buf, "build")
+
+			for _, data := range tt.writes {
+				n, err := w.Write([]byte(data))
+				assert.NoError(t, err)
+				assert.Equal(t, n, len(data))
+			}
+
+			if tt.flush {
+				assert.NoError(t, w.Flush())
+			}
+
+			assert.Equal(t, buf.String(), tt.want)
+		})
+	}
+}
+
+type failingWriter struct {
+	failAfter int
+}
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	if w.failAfter == 0 {
+		return 0, errors.New("write failed")
+	}
+
+	w.failAfter--
+
+	return len(data), nil
+}
+
+func TestPrefixWriter_WriteError(t *testing.T) {
+	w := output.NewPrefixWriter(&failingWriter{failAfter: 1}, "build")
+
+	n, err := w.Write([]byte("one\ntwo\nthree\n"))
+	assert.Error(t, err)
+	assert.Equal(t, n, len("one\n"))
+}
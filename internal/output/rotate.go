@@ -0,0 +1,170 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// RotatingFile is a log file writer that can be truncated at the beginning of every run or
+// rotated once it reaches the given size or age. Rotated files are renamed to <path>.1,
+// <path>.2 etc. and only the configured number of them is retained.
+type RotatingFile struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	keep     int
+	truncate bool
+
+	mu        sync.Mutex
+	file      *os.File
+	size      int64
+	startedAt time.Time
+}
+
+func OpenRotatingFile(path string) (*RotatingFile, error) {
+	r := &RotatingFile{
+		path: path,
+	}
+
+	if err := r.open(os.O_APPEND); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// WithMaxSize sets the size in bytes after which the file is rotated (0 - do not rotate by size).
+func (r *RotatingFile) WithMaxSize(size int64) *RotatingFile {
+	r.maxSize = size
+	return r
+}
+
+// WithMaxAge sets the age after which the file is rotated (0 - do not rotate by age).
+func (r *RotatingFile) WithMaxAge(age time.Duration) *RotatingFile {
+	r.maxAge = age
+	return r
+}
+
+// WithKeep sets the number of rotated files to retain.
+func (r *RotatingFile) WithKeep(keep int) *RotatingFile {
+	r.keep = keep
+	return r
+}
+
+// WithTruncate makes the file truncated at the beginning of every run.
+func (r *RotatingFile) WithTruncate(truncate bool) *RotatingFile {
+	r.truncate = truncate
+	return r
+}
+
+func (r *RotatingFile) Write(data []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.needsRotation(len(data)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+
+	return n, err
+}
+
+// StartRun prepares the file for a new run of the command: truncates it if configured and
+// writes the run separator header.
+func (r *RotatingFile) StartRun(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.truncate {
+		if err := r.file.Close(); err != nil {
+			return err
+		}
+
+		if err := r.open(os.O_TRUNC); err != nil {
+			return err
+		}
+	}
+
+	header := fmt.Sprintf("==== %s [%s] ====\n", time.Now().Format(time.DateTime), name)
+
+	if r.needsRotation(len(header)) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := r.file.WriteString(header)
+	r.size += int64(n)
+
+	return err
+}
+
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+func (r *RotatingFile) open(mode int) error {
+	file, err := os.OpenFile(r.path, mode|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to open output file > %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("unable to stat output file > %w", err)
+	}
+
+	r.file = file
+	r.size = info.Size()
+
+	// the age of an existing log counts from its last modification (the creation time is not
+	// available everywhere), so an old log is rotated on the first write.
+	r.startedAt = time.Now()
+	if r.size > 0 {
+		r.startedAt = info.ModTime()
+	}
+
+	return nil
+}
+
+func (r *RotatingFile) needsRotation(n int) bool {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+
+	return r.maxAge > 0 && time.Since(r.startedAt) >= r.maxAge
+}
+
+func (r *RotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+
+	if r.keep > 0 {
+		_ = os.Remove(r.backupName(r.keep))
+
+		for i := r.keep - 1; i > 0; i-- {
+			_ = os.Rename(r.backupName(i), r.backupName(i+1))
+		}
+
+		if err := os.Rename(r.path, r.backupName(1)); err != nil {
+			return fmt.Errorf("unable to rotate output file > %w", err)
+		}
+	}
+
+	return r.open(os.O_TRUNC)
+}
+
+func (r *RotatingFile) backupName(n int) string {
+	return fmt.Sprintf("%s.%d", r.path, n)
+}
@@ -0,0 +1,89 @@
+package output_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-imk/internal/output"
+	"go-imk/test/assert"
+)
+
+func TestRotatingFile_Write(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+
+	file, err := output.OpenRotatingFile(path)
+	assert.NoError(t, err)
+
+	file = file.WithMaxSize(10).WithKeep(2)
+	defer file.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		_, err := file.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	for name, want := range map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	} {
+		data, err := os.ReadFile(name)
+		assert.NoError(t, err)
+		assert.Equal(t, string(data), want)
+	}
+
+	_, err = os.Stat(path + ".3")
+	assert.Error(t, err)
+}
+
+func TestRotatingFile_StartRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+
+	file, err := output.OpenRotatingFile(path)
+	assert.NoError(t, err)
+
+	file = file.WithTruncate(true)
+	defer file.Close()
+
+	assert.NoError(t, file.StartRun("first"))
+	_, err = file.Write([]byte("first run\n"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, file.StartRun("second"))
+	_, err = file.Write([]byte("second run\n"))
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, len(lines), 2)
+	assert.Equal(t, strings.HasSuffix(lines[0], "[second] ===="), true)
+	assert.Equal(t, lines[1], "second run")
+}
+
+func TestRotatingFile_WriteOldFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	assert.NoError(t, os.WriteFile(path, []byte("old\n"), 0644))
+
+	modTime := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	file, err := output.OpenRotatingFile(path)
+	assert.NoError(t, err)
+
+	file = file.WithMaxAge(time.Hour).WithKeep(1)
+	defer file.Close()
+
+	_, err = file.Write([]byte("new\n"))
+	assert.NoError(t, err)
+
+	for name, want := range map[string]string{path: "new\n", path + ".1": "old\n"} {
+		data, err := os.ReadFile(name)
+		assert.NoError(t, err)
+		assert.Equal(t, string(data), want)
+	}
+}
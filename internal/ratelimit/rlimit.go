@@ -1,45 +1,132 @@
-// Package rlimit adds a rate limiting with given RPS.
+// Package ratelimit implements a token bucket rate limiter.
 package ratelimit
 
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 )
 
+var (
+	ErrImpossibleLease = errors.New("impossible lease requested")
+	ErrLimitExceeded   = errors.New("rate limit exceeded")
+)
+
+// Clock provides the current time and timers. It allows tests to control the time.
+type Clock interface {
+	Now() time.Time
+	After(time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// RLimit is a token bucket refilled with limit tokens per interval. The bucket holds up to burst
+// tokens (limit by default) and starts full. It is safe for concurrent use.
 type RLimit struct {
-	limit    int
-	interval time.Duration
-	rps      int
+	clock Clock
+	rate  float64 // tokens per nanosecond.
+	burst int
+
+	mu       sync.Mutex
+	tokens   float64
 	lastTime time.Time
 }
 
 func New(limit int, interval time.Duration) *RLimit {
+	clock := Clock(realClock{})
+
 	return &RLimit{
-		limit:    limit,
-		interval: interval,
-		rps:      limit,
-		lastTime: time.Now(),
+		clock:    clock,
+		rate:     float64(limit) / float64(interval),
+		burst:    limit,
+		tokens:   float64(limit),
+		lastTime: clock.Now(),
 	}
 }
 
+// WithBurst sets the maximum number of tokens that can be leased at once. The bucket is refilled.
+func (s *RLimit) WithBurst(burst int) *RLimit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.burst = burst
+	s.tokens = float64(burst)
+
+	return s
+}
+
+// WithClock replaces the real time (eg. in tests).
+func (s *RLimit) WithClock(clock Clock) *RLimit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.clock = clock
+	s.lastTime = clock.Now()
+
+	return s
+}
+
+// Lease takes n tokens if they are available. Otherwise it fails with ErrLimitExceeded without
+// waiting.
 func (s *RLimit) Lease(ctx context.Context, n int) (int, error) {
-	if n > s.limit {
-		return 0, errors.New("impossible lease requested")
+	if err := ctx.Err(); err != nil {
+		return 0, err
 	}
 
-	now := time.Now()
+	if _, err := s.take(n); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
 
-	// reset time frame
-	if now.Sub(s.lastTime) >= s.interval {
-		s.rps = s.limit
-		s.lastTime = now
+// Wait takes n tokens, waiting for them to be refilled if needed. It returns the context error if
+// the context is cancelled meanwhile.
+func (s *RLimit) Wait(ctx context.Context, n int) error {
+	for {
+		delay, err := s.take(n)
+		if err == nil {
+			return nil
+		}
+
+		if !errors.Is(err, ErrLimitExceeded) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.clock.After(delay):
+		}
 	}
+}
+
+// take takes n tokens. If there are not enough tokens, it returns how long it takes to refill
+// them together with ErrLimitExceeded.
+func (s *RLimit) take(n int) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if s.rps < n {
-		return 0, errors.New("Rate limit exceeded")
+	if n > s.burst {
+		return 0, ErrImpossibleLease
 	}
 
-	s.rps -= n
-	return n, nil
+	now := s.clock.Now()
+	if elapsed := now.Sub(s.lastTime); elapsed > 0 {
+		s.tokens = min(float64(s.burst), s.tokens+float64(elapsed)*s.rate)
+	}
+
+	s.lastTime = now
+
+	if missing := float64(n) - s.tokens; missing > 0 {
+		return time.Duration(missing/s.rate) + 1, ErrLimitExceeded
+	}
+
+	s.tokens -= float64(n)
+
+	return 0, nil
 }
@@ -2,6 +2,8 @@ package ratelimit_test
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -50,3 +52,134 @@ func TestStore_Lease(t *testing.T) {
 		})
 	}
 }
+
+// fakeClock is a manually advanced clock.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []fakeTimer
+	waiting chan struct{}
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0), waiting: make(chan struct{}, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	c.waiting <- struct{}{}
+
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+
+		timer.ch <- c.now
+	}
+
+	c.timers = pending
+}
+
+func TestRLimit_LeaseRefill(t *testing.T) {
+	clock := newFakeClock()
+	rl := ratelimit.New(2, time.Second).WithBurst(3).WithClock(clock)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		_, err := rl.Lease(ctx, 1)
+		assert.NoError(t, err)
+	}
+
+	_, err := rl.Lease(ctx, 1)
+	assert.Equal(t, errors.Is(err, ratelimit.ErrLimitExceeded), true)
+
+	// 2 tokens per second.
+	clock.Advance(500 * time.Millisecond)
+	_, err = rl.Lease(ctx, 1)
+	assert.NoError(t, err)
+
+	_, err = rl.Lease(ctx, 1)
+	assert.Equal(t, errors.Is(err, ratelimit.ErrLimitExceeded), true)
+
+	// the bucket does not grow beyond the burst.
+	clock.Advance(time.Hour)
+	_, err = rl.Lease(ctx, 3)
+	assert.NoError(t, err)
+
+	_, err = rl.Lease(ctx, 4)
+	assert.Equal(t, errors.Is(err, ratelimit.ErrImpossibleLease), true)
+}
+
+func TestRLimit_Wait(t *testing.T) {
+	clock := newFakeClock()
+	rl := ratelimit.New(1, time.Second).WithClock(clock)
+
+	assert.NoError(t, rl.Wait(context.Background(), 1))
+
+	done := make(chan error, 1)
+	go func() { done <- rl.Wait(context.Background(), 1) }()
+
+	<-clock.waiting
+	clock.Advance(time.Second)
+	assert.NoError(t, <-done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- rl.Wait(ctx, 1) }()
+
+	<-clock.waiting
+	cancel()
+	assert.Equal(t, errors.Is(<-done, context.Canceled), true)
+}
+
+func TestRLimit_Concurrent(t *testing.T) {
+	clock := newFakeClock()
+	rl := ratelimit.New(1, time.Second).WithBurst(50).WithClock(clock)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	leased := 0
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, err := rl.Lease(context.Background(), 1); err == nil {
+				mu.Lock()
+				leased++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, leased, 50)
+}
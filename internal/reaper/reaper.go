@@ -0,0 +1,43 @@
+// Package reaper makes imk the child subreaper of the processes started by the commands (Linux
+// only), so that the processes that leave their session (eg. daemonised workers) stay descendants
+// of imk instead of moving to init. The orphans are reaped by imk once they exit.
+package reaper
+
+import (
+	"os/exec"
+	"sync"
+)
+
+var (
+	mu sync.Mutex
+
+	// started holds the children started with Start - their exit status belongs to
+	// exec.Cmd.Wait, so they must not be reaped.
+	started = make(map[int]bool)
+)
+
+// Start starts the command. Once the reaping is enabled, every child process of imk must be
+// started with Start and waited for with Wait.
+func Start(cmd *exec.Cmd) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	started[cmd.Process.Pid] = true
+
+	return nil
+}
+
+// Wait waits for the command started with Start to exit.
+func Wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+
+	mu.Lock()
+	delete(started, cmd.Process.Pid)
+	mu.Unlock()
+
+	return err
+}
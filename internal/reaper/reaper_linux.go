@@ -0,0 +1,67 @@
+//go:build linux
+
+package reaper
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Enable makes imk the child subreaper and starts reaping the orphans.
+func Enable() error {
+	if err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("unable to become a child subreaper > %w", err)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, unix.SIGCHLD)
+
+	go func() {
+		for range sigCh {
+			reap()
+		}
+	}()
+
+	return nil
+}
+
+// reap waits for the exited children of imk that were not started with Start.
+func reap() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	paths, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return
+	}
+
+	self := os.Getpid()
+
+	for _, path := range paths {
+		pid, err := strconv.Atoi(filepath.Base(filepath.Dir(path)))
+		if err != nil || started[pid] {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		// the fields after the command name (which may contain spaces) - state and ppid first.
+		stat := string(data)
+		fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+		if len(fields) < 2 || fields[0] != "Z" || fields[1] != strconv.Itoa(self) {
+			continue
+		}
+
+		var status unix.WaitStatus
+		_, _ = unix.Wait4(pid, &status, unix.WNOHANG, nil)
+	}
+}
@@ -0,0 +1,75 @@
+package reaper_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-imk/internal/reaper"
+	"go-imk/test/assert"
+)
+
+func TestMain(m *testing.M) {
+	if err := reaper.Enable(); err != nil {
+		panic(err)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestReap_Orphans(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 0.1 & echo $!")
+
+	var out strings.Builder
+	cmd.Stdout = &out
+
+	assert.NoError(t, reaper.Start(cmd))
+	assert.NoError(t, reaper.Wait(cmd))
+
+	pid, err := strconv.Atoi(strings.TrimSpace(out.String()))
+	assert.NoError(t, err)
+
+	// the orphan stays in /proc (as a zombie) until it is reaped.
+	deadline := time.Now().Add(2 * time.Second)
+	for exists(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("orphan %d not reaped", pid)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWait_Status(t *testing.T) {
+	var wg sync.WaitGroup
+
+	// the orphans exiting meanwhile must not take the exit status of the started commands.
+	codes := make([]int, 20)
+	for i := range codes {
+		wg.Go(func() {
+			codes[i] = -1
+
+			cmd := exec.Command("sh", "-c", "sleep 0.01 & exit "+strconv.Itoa(i%3))
+			if err := reaper.Start(cmd); err == nil {
+				_ = reaper.Wait(cmd)
+				codes[i] = cmd.ProcessState.ExitCode()
+			}
+		})
+	}
+
+	wg.Wait()
+
+	for i, code := range codes {
+		assert.Equal(t, code, i%3)
+	}
+}
+
+func exists(pid int) bool {
+	_, err := os.Stat(filepath.Join("/proc", strconv.Itoa(pid)))
+	return err == nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package reaper
+
+// Enable does nothing - the child subreapers are Linux only.
+func Enable() error {
+	return nil
+}
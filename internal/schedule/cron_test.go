@@ -0,0 +1,78 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+
+	"go-imk/internal/schedule"
+	"go-imk/test/assert"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	// Wednesday.
+	now := time.Date(2024, time.January, 10, 14, 7, 30, 0, time.Local)
+
+	tests := []struct {
+		name string
+		expr string
+		want time.Time
+	}{
+		{
+			name: "should run every minute",
+			expr: "* * * * *",
+			want: time.Date(2024, time.January, 10, 14, 8, 0, 0, time.Local),
+		},
+		{
+			name: "should support steps",
+			expr: "*/15 * * * *",
+			want: time.Date(2024, time.January, 10, 14, 15, 0, 0, time.Local),
+		},
+		{
+			name: "should support ranges and lists",
+			expr: "0 9-12,18 * * *",
+			want: time.Date(2024, time.January, 10, 18, 0, 0, 0, time.Local),
+		},
+		{
+			name: "should support day names",
+			expr: "30 3 * * sat,sun",
+			want: time.Date(2024, time.January, 13, 3, 30, 0, 0, time.Local),
+		},
+		{
+			name: "should match either day of month or day of week",
+			expr: "0 0 11 * mon",
+			want: time.Date(2024, time.January, 11, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name: "should support shortcuts and month names",
+			expr: "@monthly",
+			want: time.Date(2024, time.February, 1, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name: "should skip short months",
+			expr: "0 0 31 jan-dec/1 *",
+			want: time.Date(2024, time.January, 31, 0, 0, 0, 0, time.Local),
+		},
+		{
+			name: "should treat 7 as sunday",
+			expr: "0 12 * * 7",
+			want: time.Date(2024, time.January, 14, 12, 0, 0, 0, time.Local),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := schedule.ParseCron(tt.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, cron.Next(now), tt.want)
+		})
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@often", "0 0 30 feb *"} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := schedule.ParseCron(expr)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+// Package schedule triggers the commands periodically - at a fixed interval or at the times
+// given by a cron expression.
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Schedule determines when the commands are triggered.
+type Schedule interface {
+	// Next returns the first activation time after the given time.
+	Next(time.Time) time.Time
+	String() string
+}
+
+type every struct {
+	interval time.Duration
+}
+
+// Every returns a schedule that activates at a fixed interval.
+func Every(interval time.Duration) Schedule {
+	return every{interval: interval}
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(e.interval)
+}
+
+func (e every) String() string {
+	return fmt.Sprintf("every %s", e.interval)
+}
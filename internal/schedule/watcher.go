@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go-imk/internal/fsops"
+	"go-imk/internal/logger"
+)
+
+// Watcher is an fsops.Watcher that reports a synthetic TIMER event on every activation of the
+// schedules. The next activation is only planned once the event was consumed, so the activations
+// that pass while the commands are running are not queued up. The planned activations survive
+// restarts of the watch, so the same Watcher should be reused.
+type Watcher struct {
+	schedules []Schedule
+
+	mu   sync.Mutex
+	next []time.Time // planned activations of the schedules (zero - not planned yet).
+}
+
+func NewWatcher(schedules ...Schedule) *Watcher {
+	return &Watcher{
+		schedules: schedules,
+		next:      make([]time.Time, len(schedules)),
+	}
+}
+
+func (w *Watcher) Watch(ctx context.Context) (chan *fsops.Event, error) {
+	events := make(chan *fsops.Event)
+
+	var wg sync.WaitGroup
+
+	for i := range w.schedules {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			w.run(ctx, i, events)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events, nil
+}
+
+// Err always returns nil - the schedules cannot fail.
+func (w *Watcher) Err() error {
+	return nil
+}
+
+func (w *Watcher) run(ctx context.Context, i int, events chan *fsops.Event) {
+	schedule := w.schedules[i]
+
+	for {
+		next := w.plan(i)
+		if next.IsZero() {
+			// closing the events would stop the other watchers as well.
+			logger.Shoutf("%s never activates", schedule)
+			<-ctx.Done()
+
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			select {
+			case events <- &fsops.Event{Op: fsops.OpTimer, Path: schedule.String(), Time: now}:
+				w.done(i)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// plan returns the planned activation of the schedule, planning it if needed.
+func (w *Watcher) plan(i int) time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.next[i].IsZero() {
+		w.next[i] = w.schedules[i].Next(time.Now())
+	}
+
+	return w.next[i]
+}
+
+// done marks the planned activation of the schedule as reported.
+func (w *Watcher) done(i int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.next[i] = time.Time{}
+}
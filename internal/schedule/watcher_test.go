@@ -0,0 +1,59 @@
+package schedule_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-imk/internal/fsops"
+	"go-imk/internal/schedule"
+	"go-imk/test/assert"
+)
+
+func TestWatcher_WatchRestart(t *testing.T) {
+	watcher := schedule.NewWatcher(schedule.Every(300 * time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := watcher.Watch(ctx)
+	assert.NoError(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := watcher.Watch(ctx)
+	assert.NoError(t, err)
+
+	// the activation planned before the restart is kept.
+	select {
+	case event := <-events:
+		assert.Equal(t, event.Op, fsops.OpTimer)
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("timed out waiting for event")
+	}
+}
+
+type never struct{}
+
+func (never) Next(time.Time) time.Time { return time.Time{} }
+func (never) String() string           { return "never" }
+
+func TestWatcher_WatchNever(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, err := schedule.NewWatcher(never{}).Watch(ctx)
+	assert.NoError(t, err)
+
+	select {
+	case <-events:
+		t.Fatal("events closed before the context was cancelled")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+
+	_, ok := <-events
+	assert.Equal(t, ok, false)
+}